@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	ScopeRead    = "read"
+	ScopeTrigger = "trigger"
+	// ScopeAdmin grants every other scope.
+	ScopeAdmin = "admin"
+
+	contextKey = "api_token"
+)
+
+type token struct {
+	name    string
+	hash    []byte
+	scopes  map[string]bool
+	limiter *rate.Limiter
+}
+
+type Authenticator struct {
+	logger *zerolog.Logger
+	mu     sync.RWMutex
+	tokens []*token
+}
+
+func New(l *zerolog.Logger, tokens []config.ApiToken) *Authenticator {
+	logger := l.With().Str("type", "auth").Logger()
+
+	a := &Authenticator{logger: &logger}
+	a.Reload(tokens)
+	return a
+}
+
+// Reload replaces the accepted tokens. Rate limiter state survives for
+// tokens whose secret and limit are unchanged.
+func (a *Authenticator) Reload(tokens []config.ApiToken) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous := a.tokens
+	a.tokens = nil
+	for _, t := range tokens {
+		hash, _ := hex.DecodeString(t.TokenSha256)
+		if t.Token != "" {
+			sum := sha256.Sum256([]byte(t.Token))
+			hash = sum[:]
+		}
+
+		scopes := make(map[string]bool, len(t.Scopes))
+		for _, s := range t.Scopes {
+			scopes[s] = true
+		}
+
+		var limiter *rate.Limiter
+		if t.RateLimit > 0 {
+			limit := rate.Limit(t.RateLimit / 60)
+			for _, p := range previous {
+				if p.limiter != nil && p.limiter.Limit() == limit && subtle.ConstantTimeCompare(p.hash, hash) == 1 {
+					limiter = p.limiter
+				}
+			}
+			if limiter == nil {
+				limiter = rate.NewLimiter(limit, int(math.Ceil(t.RateLimit)))
+			}
+		}
+
+		a.tokens = append(a.tokens, &token{name: t.Name, hash: hash, scopes: scopes, limiter: limiter})
+	}
+
+	if len(a.tokens) == 0 {
+		a.logger.Warn().Msg("No api_tokens configured, every authenticated API route will return 401")
+	}
+}
+
+// Middleware authenticates the bearer token of every request except the
+// public paths and applies the token's rate limit. Scopes are checked per
+// route with Require. Public paths accept a token but don't require one, so
+// they can show more to authenticated callers.
+func (a *Authenticator) Middleware(public ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, p := range public {
+				if c.Path() == p {
+					if t := a.lookup(bearer(c.Request())); t != nil {
+						c.Set(contextKey, t)
+					}
+					return next(c)
+				}
+			}
+
+			t := a.lookup(bearer(c.Request()))
+			if t == nil {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="servers-stats"`)
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Missing or invalid API token",
+				})
+			}
+
+			if t.limiter != nil {
+				r := t.limiter.Reserve()
+				if delay := r.Delay(); delay > 0 {
+					r.Cancel()
+					a.logger.Warn().Str("token", t.name).Str("uri", c.Request().RequestURI).Msg("Rate limit exceeded")
+					c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+					return c.JSON(http.StatusTooManyRequests, map[string]string{
+						"error": "Rate limit exceeded",
+					})
+				}
+			}
+
+			c.Set(contextKey, t)
+			return next(c)
+		}
+	}
+}
+
+// Require rejects requests whose token lacks scope.
+func Require(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			t, ok := c.Get(contextKey).(*token)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Missing or invalid API token",
+				})
+			}
+			if !t.scopes[scope] && !t.scopes[ScopeAdmin] {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "Token lacks the " + scope + " scope",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// HasScope reports whether c was authenticated with a token granting scope.
+func HasScope(c echo.Context, scope string) bool {
+	t, ok := c.Get(contextKey).(*token)
+	return ok && (t.scopes[scope] || t.scopes[ScopeAdmin])
+}
+
+// TokenName returns the name of the token that authenticated c, if any.
+func TokenName(c echo.Context) string {
+	if t, ok := c.Get(contextKey).(*token); ok {
+		return t.name
+	}
+	return ""
+}
+
+// lookup compares the presented token against every configured hash so the
+// time taken does not depend on which token, if any, matched.
+func (a *Authenticator) lookup(presented string) *token {
+	if presented == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(presented))
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var match *token
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			match = t
+		}
+	}
+	return match
+}
+
+func bearer(r *http.Request) string {
+	h := r.Header.Get(echo.HeaderAuthorization)
+	scheme, value, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
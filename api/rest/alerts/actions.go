@@ -0,0 +1,35 @@
+package alerts
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+)
+
+type alertsView struct {
+	Active []store.AlertEvent `json:"active"`
+	Recent []store.AlertEvent `json:"recent"`
+}
+
+func Alerts(e *echo.Echo, st *store.Store) {
+	e.GET("/api/v1/alerts", handleAlerts(st), auth.Require(auth.ScopeRead))
+}
+
+func handleAlerts(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		out := alertsView{
+			Active: st.ActiveAlerts(),
+			Recent: st.AlertsSince(time.Now().Add(-24 * time.Hour)),
+		}
+		if out.Active == nil {
+			out.Active = []store.AlertEvent{}
+		}
+		if out.Recent == nil {
+			out.Recent = []store.AlertEvent{}
+		}
+		return c.JSON(http.StatusOK, out)
+	}
+}
@@ -0,0 +1,128 @@
+package async_jobs
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const maxWait = 60 * time.Second
+
+func Jobs(l *zerolog.Logger, e *echo.Echo, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor) {
+	tasks := newTaskStore()
+
+	e.POST("/api/v1/jobs/:type", handleSubmit(l, cfg, b, st, ex, tasks), auth.Require(auth.ScopeTrigger))
+	e.GET("/api/v1/jobs/:id", handleStatus(tasks), auth.Require(auth.ScopeRead))
+}
+
+func handleSubmit(l *zerolog.Logger, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor, tasks *taskStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		def, ok := job.Lookup(c.Param("type"))
+		if !ok || (def.Route == "" && !def.Command) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Unknown job type " + c.Param("type"),
+			})
+		}
+
+		notify := true
+		if raw := c.QueryParam("notify"); raw != "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "notify must be true or false",
+				})
+			}
+			notify = v
+		}
+
+		if ex.Closed() {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Server is shutting down",
+			})
+		}
+
+		if !b.CanExecuteCommand(def) {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{
+				"error": def.Title + " is already running or rate limited",
+			})
+		}
+
+		var notifier common.Notifier = b
+		if !notify {
+			notifier = common.LogNotifier{Logger: l}
+		}
+
+		t := tasks.create(def.Name, notify)
+		go func() {
+			res := b.ExecuteJob(def, job.Deps{
+				Logger:   l,
+				Config:   cfg.Get(),
+				Store:    st,
+				Notifier: notifier,
+				Trigger:  job.TriggerAPI,
+			})
+			tasks.finish(t, res)
+		}()
+
+		location := "/api/v1/jobs/" + t.ID
+		c.Response().Header().Set(echo.HeaderLocation, location)
+		return c.JSON(http.StatusAccepted, map[string]string{
+			"id":     t.ID,
+			"type":   def.Name,
+			"status": StatusRunning,
+			"href":   location,
+		})
+	}
+}
+
+func handleStatus(tasks *taskStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+
+		var wait time.Duration
+		if raw := c.QueryParam("wait"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d < 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "wait must be a duration such as 30s",
+				})
+			}
+			wait = min(d, maxWait)
+		}
+
+		t, done, ok := tasks.get(id)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Unknown task id " + id,
+			})
+		}
+
+		if t.Status == StatusRunning && wait > 0 {
+			// Keep http.write_timeout from cutting the long poll short
+			_ = http.NewResponseController(c.Response()).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-done:
+				t, _, _ = tasks.get(id)
+			case <-timer.C:
+			case <-c.Request().Context().Done():
+				// The client went away, there is no one to answer
+				return nil
+			}
+		}
+
+		return c.JSON(http.StatusOK, t)
+	}
+}
@@ -0,0 +1,14 @@
+package async_jobs
+
+import (
+	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+func REST(l *zerolog.Logger, e *echo.Echo, c *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor) {
+	Jobs(l, e, c, b, st, ex)
+}
@@ -0,0 +1,95 @@
+package async_jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/cron/job"
+)
+
+const (
+	maxTasks = 200
+
+	StatusRunning = "running"
+)
+
+type task struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	Notify     bool       `json:"notify"`
+	Result     any        `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	done       chan struct{}
+}
+
+// taskStore keeps the most recent async job submissions in memory so
+// callers can poll for their results.
+type taskStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*task
+	order []string
+}
+
+func newTaskStore() *taskStore {
+	return &taskStore{tasks: make(map[string]*task)}
+}
+
+func (s *taskStore) create(jobType string, notify bool) *task {
+	t := &task{
+		ID:        newID(),
+		Type:      jobType,
+		Status:    StatusRunning,
+		Notify:    notify,
+		CreatedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tasks[t.ID] = t
+	s.order = append(s.order, t.ID)
+	if len(s.order) > maxTasks {
+		delete(s.tasks, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return t
+}
+
+func (s *taskStore) finish(t *task, res job.RunResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	t.Status = res.Outcome
+	t.Result = res.Result
+	if res.Err != nil {
+		t.Error = res.Err.Error()
+	}
+	t.FinishedAt = &now
+	close(t.done)
+}
+
+// get returns a snapshot of the task safe to encode outside the lock.
+func (s *taskStore) get(id string) (task, <-chan struct{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tasks[id]
+	if !ok {
+		return task{}, nil, false
+	}
+	return *t, t.done, true
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
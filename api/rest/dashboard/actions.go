@@ -0,0 +1,34 @@
+package dashboard
+
+import (
+	"embed"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed static
+var static embed.FS
+
+// Dashboard serves the page and its assets without authentication; the page
+// asks for an API token and sends it with every API call it makes.
+func Dashboard(e *echo.Echo) {
+	e.GET("/", func(c echo.Context) error {
+		return serve(c, "index.html")
+	})
+	e.GET("/assets/:file", func(c echo.Context) error {
+		return serve(c, c.Param("file"))
+	})
+}
+
+func serve(c echo.Context, name string) error {
+	raw, err := static.ReadFile(path.Join("static", path.Base(name)))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+	return c.Blob(http.StatusOK, mime.TypeByExtension(path.Ext(name)), raw)
+}
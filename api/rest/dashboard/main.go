@@ -0,0 +1,9 @@
+package dashboard
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+func REST(e *echo.Echo) {
+	Dashboard(e)
+}
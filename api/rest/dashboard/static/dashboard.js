@@ -0,0 +1,318 @@
+"use strict";
+
+const tokenKey = "servers-stats-token";
+const svgNS = "http://www.w3.org/2000/svg";
+
+function token() {
+  return localStorage.getItem(tokenKey) || "";
+}
+
+async function api(path, options) {
+  const headers = { Authorization: "Bearer " + token() };
+  if (options && options.contentType) headers["Content-Type"] = options.contentType;
+  const res = await fetch(path, Object.assign({}, options, { headers }));
+  if (res.status === 401) throw new Error("Enter a valid API token");
+  if (res.status === 403) throw new Error("The API token lacks the scope for " + path);
+  if (res.status === 404) return null;
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error || res.statusText);
+  return body;
+}
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k === "class") node.className = v;
+    else if (k.startsWith("on")) node.addEventListener(k.slice(2), v);
+    else node[k] = v;
+  }
+  children.forEach(c => c !== null && c !== undefined && node.append(c));
+  return node;
+}
+
+function svg(tag, attrs) {
+  const node = document.createElementNS(svgNS, tag);
+  for (const [k, v] of Object.entries(attrs || {})) node.setAttribute(k, v);
+  return node;
+}
+
+function fill(id, ...children) {
+  const node = document.getElementById(id);
+  node.textContent = "";
+  children.forEach(c => node.append(c));
+}
+
+function showError(err) {
+  const node = document.getElementById("error");
+  node.hidden = !err;
+  node.textContent = err ? err.message : "";
+}
+
+function ago(ts) {
+  if (!ts) return "never";
+  const s = Math.round((Date.now() - new Date(ts)) / 1000);
+  if (s < 60) return s + "s ago";
+  if (s < 3600) return Math.round(s / 60) + "m ago";
+  if (s < 86400) return Math.round(s / 3600) + "h ago";
+  return Math.round(s / 86400) + "d ago";
+}
+
+function remaining(ts) {
+  const s = Math.round((new Date(ts) - Date.now()) / 1000);
+  if (s < 3600) return "for " + Math.max(1, Math.round(s / 60)) + "m";
+  if (s < 86400) return "for " + Math.round(s / 3600) + "h";
+  return "for " + Math.round(s / 86400) + "d";
+}
+
+function gb(bytes) {
+  return (bytes / 1024 / 1024 / 1024).toFixed(1) + " GB";
+}
+
+// gauge draws a half circle filled to percent.
+function gauge(percent, status) {
+  const r = 50, cx = 60, cy = 60;
+  const angle = Math.PI * (1 - Math.min(percent, 100) / 100);
+  const x = cx + r * Math.cos(angle), y = cy - r * Math.sin(angle);
+  const node = svg("svg", { class: "gauge", width: 120, height: 70, viewBox: "0 0 120 70" });
+  node.append(svg("path", { d: `M10 60 A50 50 0 0 1 110 60`, fill: "none", stroke: "#eef0f3", "stroke-width": 10 }));
+  if (percent > 0) {
+    node.append(svg("path", { d: `M10 60 A50 50 0 0 1 ${x.toFixed(1)} ${y.toFixed(1)}`, fill: "none", stroke: `var(--${status || "ok"})`, "stroke-width": 10 }));
+  }
+  const label = svg("text", { x: cx, y: 58, "text-anchor": "middle", "font-size": 18, "font-weight": 700 });
+  label.textContent = percent + "%";
+  node.append(label);
+  return node;
+}
+
+// line draws one polyline per series scaled to a shared y axis.
+function line(cls, width, height, series) {
+  const node = svg("svg", { class: cls, viewBox: `0 0 ${width} ${height}`, preserveAspectRatio: "none" });
+  const all = series.flatMap(s => s.points);
+  if (all.length < 2) return node;
+  const xs = all.map(p => p[0]), ys = all.map(p => p[1]);
+  const x0 = Math.min(...xs), x1 = Math.max(...xs) || x0 + 1;
+  const y0 = Math.min(0, ...ys), y1 = Math.max(...ys) || 1;
+  for (const s of series) {
+    const pts = s.points.map(([x, y]) =>
+      `${((x - x0) / (x1 - x0 || 1) * width).toFixed(1)},${(height - 2 - (y - y0) / (y1 - y0 || 1) * (height - 4)).toFixed(1)}`);
+    node.append(svg("polyline", { points: pts.join(" "), fill: "none", stroke: s.color, "stroke-width": 2, "vector-effect": "non-scaling-stroke" }));
+  }
+  return node;
+}
+
+async function loadAlerts() {
+  const [data, silences] = await Promise.all([api("/api/v1/alerts"), api("/api/v1/silences")]);
+  const silenced = new Set((silences || []).map(s => s.key));
+  const rows = data.active.map(a => el("tr", {},
+    el("td", {}, el("span", { class: "badge " + a.status, textContent: a.status })),
+    el("td", { textContent: a.detail }),
+    el("td", {}, silenced.has(a.key) ? el("span", { class: "badge", textContent: "silenced" }) : null),
+    el("td", { class: "muted", textContent: "since " + ago(a.at) })));
+  fill("alerts",
+    rows.length ? el("table", {}, ...rows) : el("div", { class: "ok", textContent: "No active alerts" }),
+    el("div", { class: "muted", textContent: `${data.recent.length} alert transitions in the last 24h` }));
+}
+
+async function loadDisks() {
+  const disks = await api("/api/v1/disks");
+  if (!disks.length) {
+    fill("disks", el("div", { class: "panel muted", textContent: "No disk samples yet" }));
+    return;
+  }
+  const cards = await Promise.all(disks.map(async d => {
+    const history = await api(`/api/v1/disks/${encodeURIComponent(d.name)}/history?since=168h`) || [];
+    const points = history.map(h => [new Date(h.sampled_at).getTime(), h.percent]);
+    return el("div", { class: "card" },
+      el("h3", {}, d.name + " ", el("span", { class: "badge " + d.status, textContent: d.status })),
+      el("div", { class: "muted", textContent: d.path }),
+      gauge(d.percent, d.status),
+      el("div", { textContent: `${gb(d.used_bytes)} used of ${gb(d.total_bytes)}` }),
+      el("div", { class: "muted", textContent: d.inodes.total ? `inodes ${d.inodes.percent}% used` : "" }),
+      line("sparkline", 200, 36, [{ color: "#2f80ed", points }]),
+      el("div", { class: "muted", textContent: "7 day trend · sampled " + ago(d.sampled_at) }));
+  }));
+  fill("disks", ...cards);
+}
+
+async function loadSpeedTest() {
+  const [latest, history] = await Promise.all([
+    api("/api/v1/speedtest/latest"),
+    api("/api/v1/speedtest/history?since=168h"),
+  ]);
+  if (!latest) {
+    fill("speedtest", el("div", { class: "muted", textContent: "No speedtest results yet" }));
+    return;
+  }
+  const series = key => (history || []).map(s => [new Date(s.sampled_at).getTime(), s[key]]);
+  fill("speedtest",
+    el("div", { class: "figures" },
+      el("div", {}, el("div", { class: "muted", textContent: "Download" }), el("b", { textContent: latest.download_mbps.toFixed(1) }), " Mbps"),
+      el("div", {}, el("div", { class: "muted", textContent: "Upload" }), el("b", { textContent: latest.upload_mbps.toFixed(1) }), " Mbps"),
+      el("div", {}, el("div", { class: "muted", textContent: "Ping" }), el("b", { textContent: latest.ping_ms.toFixed(1) }), " ms"),
+      el("div", {}, el("div", { class: "muted", textContent: "Status" }), el("span", { class: "badge " + latest.status, textContent: latest.status }))),
+    el("div", { class: "muted", textContent: `${latest.isp || "n/a"} · ${latest.server} · ${ago(latest.sampled_at)}` }),
+    line("chart", 600, 160, [
+      { color: "#2f80ed", points: series("download_mbps") },
+      { color: "#27ae60", points: series("upload_mbps") },
+    ]),
+    el("div", { class: "legend" },
+      el("span", { style: "color:#2f80ed", textContent: "■ download" }),
+      el("span", { style: "color:#27ae60", textContent: "■ upload" }),
+      el("span", { class: "muted", textContent: "last 7 days" })));
+}
+
+async function expireSilence(id, button) {
+  button.disabled = true;
+  try {
+    await api(`/api/v1/silences/${encodeURIComponent(id)}`, { method: "DELETE" });
+    refresh("silences", "alerts");
+  } catch (err) {
+    showError(err);
+    button.disabled = false;
+  }
+}
+
+async function createSilence(form) {
+  const body = {
+    key: form.elements.key.value,
+    duration: form.elements.duration.value,
+    comment: form.elements.comment.value,
+  };
+  try {
+    await api("/api/v1/silences", { method: "POST", body: JSON.stringify(body), contentType: "application/json" });
+    form.elements.comment.value = "";
+    refresh("silences", "alerts");
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function loadSilences() {
+  const [silences, disks] = await Promise.all([api("/api/v1/silences"), api("/api/v1/disks")]);
+  const rows = (silences || []).map(s => {
+    const button = el("button", { textContent: "Expire" });
+    button.addEventListener("click", () => expireSilence(s.id, button));
+    return el("tr", {},
+      el("td", { textContent: s.key }),
+      el("td", { textContent: remaining(s.until) }),
+      el("td", { textContent: s.comment || "" }),
+      el("td", { class: "muted", textContent: s.created_by ? `by ${s.created_by}, ${ago(s.created_at)}` : ago(s.created_at) }),
+      el("td", {}, button));
+  });
+
+  const keys = ["speedtest", ...(disks || []).map(d => "disk:" + d.name)];
+  const form = el("form", { class: "silence-form" },
+    el("select", { name: "key" }, ...keys.map(k => el("option", { value: k, textContent: k }))),
+    el("select", { name: "duration" }, ...[["1h", "1 hour"], ["8h", "8 hours"], ["24h", "1 day"], ["168h", "7 days"]]
+      .map(([value, label]) => el("option", { value, textContent: label }))),
+    el("input", { name: "comment", placeholder: "Comment" }),
+    el("button", { type: "submit", textContent: "Silence" }));
+  form.addEventListener("submit", e => {
+    e.preventDefault();
+    createSilence(form);
+  });
+
+  fill("silences",
+    rows.length ? el("table", {}, ...rows) : el("div", { class: "muted", textContent: "No silences; scheduled runs notify as usual" }),
+    form);
+}
+
+async function trigger(name, button) {
+  button.disabled = true;
+  try {
+    await api(`/api/v1/jobs/${encodeURIComponent(name)}`, { method: "POST" });
+    button.textContent = "Started";
+  } catch (err) {
+    showError(err);
+    button.disabled = false;
+  }
+}
+
+async function loadJobs() {
+  const jobs = await api("/jobs");
+  const rows = jobs.map(j => {
+    const run = j.last_run;
+    const button = el("button", { textContent: "Run", disabled: j.running || !j.triggerable });
+    button.addEventListener("click", () => trigger(j.name, button));
+    return el("tr", {},
+      el("td", {}, el("div", { textContent: j.title || j.name }), el("div", { class: "muted", textContent: j.name })),
+      el("td", { textContent: j.enabled ? j.schedule : "—" }),
+      el("td", {}, j.running
+        ? el("span", { class: "badge", textContent: "running" })
+        : run ? el("span", { class: "badge " + run.outcome, textContent: run.outcome }) : el("span", { class: "muted", textContent: "never run" })),
+      el("td", { class: "muted", textContent: run ? `${ago(run.started_at)} via ${run.trigger}, ${run.duration_seconds.toFixed(1)}s` : "" }),
+      el("td", {}, j.triggerable ? button : null));
+  });
+  fill("jobs", el("table", {},
+    el("tr", {}, ...["Job", "Schedule", "Last run", "", ""].map(h => el("th", { textContent: h }))),
+    ...rows));
+}
+
+const loaders = { alerts: loadAlerts, silences: loadSilences, disks: loadDisks, speedtest: loadSpeedTest, jobs: loadJobs };
+const pending = {};
+
+function refresh(...sections) {
+  for (const s of sections) {
+    clearTimeout(pending[s]);
+    pending[s] = setTimeout(() => loaders[s]().then(() => showError(null), showError), 300);
+  }
+}
+
+const sectionsFor = {
+  "job.started": ["jobs"],
+  "job.finished": ["jobs"],
+  "disk.sample": ["disks"],
+  "speedtest.result": ["speedtest"],
+  "alert": ["alerts"],
+  "silence": ["silences", "alerts"],
+};
+
+// stream follows /api/v1/events with fetch instead of EventSource, which
+// cannot send the Authorization header.
+async function stream() {
+  const live = document.getElementById("live");
+  let lastId = "";
+  for (;;) {
+    try {
+      const headers = { Authorization: "Bearer " + token() };
+      if (lastId) headers["Last-Event-ID"] = lastId;
+      const res = await fetch("/api/v1/events", { headers });
+      if (!res.ok) throw new Error(res.statusText);
+      live.classList.add("on");
+
+      const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buf = "";
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        buf += value;
+        let idx;
+        while ((idx = buf.indexOf("\n\n")) >= 0) {
+          const chunk = buf.slice(0, idx);
+          buf = buf.slice(idx + 2);
+          let type = "";
+          for (const row of chunk.split("\n")) {
+            if (row.startsWith("id: ")) lastId = row.slice(4);
+            if (row.startsWith("event: ")) type = row.slice(7);
+          }
+          refresh(...(sectionsFor[type] || []));
+        }
+      }
+    } catch (err) {
+      // reconnect below
+    }
+    live.classList.remove("on");
+    await new Promise(r => setTimeout(r, 5000));
+  }
+}
+
+document.getElementById("token-form").addEventListener("submit", e => {
+  e.preventDefault();
+  localStorage.setItem(tokenKey, document.getElementById("token").value.trim());
+  document.getElementById("token").value = "";
+  refresh(...Object.keys(loaders));
+});
+
+refresh(...Object.keys(loaders));
+setInterval(() => refresh("jobs"), 60000);
+stream();
@@ -0,0 +1,104 @@
+package disks
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+)
+
+type inodesView struct {
+	Total   uint64 `json:"total"`
+	Used    uint64 `json:"used"`
+	Free    uint64 `json:"free"`
+	Percent int    `json:"percent"`
+}
+
+type diskView struct {
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	UsedBytes  float64    `json:"used_bytes"`
+	AvailBytes float64    `json:"avail_bytes"`
+	TotalBytes float64    `json:"total_bytes"`
+	Percent    int        `json:"percent"`
+	Inodes     inodesView `json:"inodes"`
+	Status     string     `json:"status"`
+	SampledAt  time.Time  `json:"sampled_at"`
+}
+
+func Disks(e *echo.Echo, st *store.Store) {
+	e.GET("/api/v1/disks", handleDisks(st), auth.Require(auth.ScopeRead))
+	e.GET("/api/v1/disks/:name", handleDisk(st), auth.Require(auth.ScopeRead))
+	e.GET("/api/v1/disks/:name/history", handleDiskHistory(st), auth.Require(auth.ScopeRead))
+}
+
+func handleDisks(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		samples := st.LatestDiskSamples()
+		out := make([]diskView, 0, len(samples))
+		for _, s := range samples {
+			out = append(out, newDiskView(s))
+		}
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func handleDisk(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		for _, s := range st.LatestDiskSamples() {
+			if s.Name == name {
+				return c.JSON(http.StatusOK, newDiskView(s))
+			}
+		}
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "No samples for disk " + name,
+		})
+	}
+}
+
+func handleDiskHistory(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		since := 24 * time.Hour
+		if raw := c.QueryParam("since"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "since must be a duration such as 24h",
+				})
+			}
+			since = d
+		}
+
+		name := c.Param("name")
+		out := []diskView{}
+		for _, s := range st.DiskSamplesSince(time.Now().Add(-since)) {
+			if s.Name == name {
+				out = append(out, newDiskView(s))
+			}
+		}
+
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func newDiskView(s store.DiskSample) diskView {
+	return diskView{
+		Name:       s.Name,
+		Path:       s.Path,
+		UsedBytes:  s.UsedBytes,
+		AvailBytes: s.AvailBytes,
+		TotalBytes: s.UsedBytes + s.AvailBytes,
+		Percent:    s.Percentage,
+		Inodes: inodesView{
+			Total:   s.InodesTotal,
+			Used:    s.InodesUsed,
+			Free:    s.InodesTotal - s.InodesUsed,
+			Percent: s.InodesPercent,
+		},
+		Status:    s.Status,
+		SampledAt: s.SampledAt,
+	}
+}
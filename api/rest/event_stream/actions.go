@@ -0,0 +1,97 @@
+package event_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+func Stream(l *zerolog.Logger, e *echo.Echo, ev *events.Bus) {
+	logger := l.With().Str("type", "events").Logger()
+
+	e.GET("/api/v1/events", handleStream(&logger, ev), auth.Require(auth.ScopeRead))
+}
+
+func handleStream(l *zerolog.Logger, ev *events.Bus) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// EventSource sends Last-Event-ID on reconnect; the query parameter
+		// lets a fresh connection resume too.
+		raw := c.Request().Header.Get("Last-Event-ID")
+		if raw == "" {
+			raw = c.QueryParam("last_event_id")
+		}
+		var lastID uint64
+		if raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Last-Event-ID must be a number",
+				})
+			}
+			lastID = id
+		}
+
+		backlog, ch, cancel := ev.Subscribe(lastID)
+		defer cancel()
+
+		res := c.Response()
+		// The stream outlives http.write_timeout by design
+		if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+			l.Debug().Err(err).Msg("Failed to lift write deadline")
+		}
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		// Stop nginx from buffering the stream
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+
+		for _, e := range backlog {
+			if err := write(res, e); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case e, ok := <-ch:
+				if !ok {
+					l.Debug().Msg("Event stream closed")
+					return nil
+				}
+				if err := write(res, e); err != nil {
+					return nil
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+			}
+			res.Flush()
+		}
+	}
+}
+
+func write(res *echo.Response, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,11 @@
+package event_stream
+
+import (
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+func REST(l *zerolog.Logger, e *echo.Echo, ev *events.Bus) {
+	Stream(l, e, ev)
+}
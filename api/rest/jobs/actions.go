@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"net/http"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+
+	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/labstack/echo/v4"
+)
+
+func Trigger(l *zerolog.Logger, e *echo.Echo, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor) {
+	logger := l.With().Str("type", "jobs").Logger()
+
+	for _, def := range job.Definitions() {
+		if def.Route == "" {
+			continue
+		}
+		e.POST(def.Route, handleTrigger(l, cfg, b, st, ex, def), auth.Require(auth.ScopeTrigger))
+		// GET triggers predate the read-only API and are kept for old clients
+		e.GET(def.Route, deprecated(&logger, handleTrigger(l, cfg, b, st, ex, def)), auth.Require(auth.ScopeTrigger))
+	}
+}
+
+// deprecated marks the response of h with a Deprecation header and logs the
+// caller, so the clients still using it can be found.
+func deprecated(l *zerolog.Logger, h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		l.Warn().Str("path", c.Path()).Str("remote_ip", c.RealIP()).Str("user_agent", c.Request().UserAgent()).Msg("Deprecated GET trigger used, switch the client to POST")
+		c.Response().Header().Set("Deprecation", "true")
+		return h(c)
+	}
+}
+
+func handleTrigger(l *zerolog.Logger, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor, def job.Definition) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if ex.Closed() {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Server is shutting down",
+			})
+		}
+
+		if !b.CanExecuteCommand(def) {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{
+				"error": def.Title + " is already running or rate limited",
+			})
+		}
+
+		go b.ExecuteJob(def, job.Deps{
+			Logger:   l,
+			Config:   cfg.Get(),
+			Store:    st,
+			Notifier: b,
+			Trigger:  job.TriggerAPI,
+		})
+
+		return c.JSON(http.StatusAccepted, map[string]string{
+			"message": def.Title + " started",
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+)
+
+type jobView struct {
+	Name        string      `json:"name"`
+	Title       string      `json:"title,omitempty"`
+	Enabled     bool        `json:"enabled"`
+	Schedule    string      `json:"schedule,omitempty"`
+	Triggerable bool        `json:"triggerable"`
+	Running     bool        `json:"running"`
+	LastRun     *jobRunView `json:"last_run"`
+}
+
+type jobRunView struct {
+	Job             string    `json:"job"`
+	Trigger         string    `json:"trigger"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Outcome         string    `json:"outcome"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func History(e *echo.Echo, cfg *config.Live, st *store.Store, ex *job.Executor) {
+	e.GET("/jobs", handleJobs(cfg, st, ex), auth.Require(auth.ScopeRead))
+	e.GET("/jobs/:name/runs", handleJobRuns(st), auth.Require(auth.ScopeRead))
+}
+
+func handleJobs(cfg *config.Live, st *store.Store, ex *job.Executor) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conf := cfg.Get()
+		defs := job.Definitions()
+		out := make([]jobView, 0, len(defs))
+
+		for _, def := range defs {
+			v := jobView{
+				Name:        def.Name,
+				Title:       def.Title,
+				Triggerable: def.Route != "" || def.Command,
+				Running:     ex.Running(def.Name),
+			}
+			if def.Schedule != nil {
+				v.Enabled = def.Enabled(conf)
+				v.Schedule = def.Schedule(conf)
+			}
+			if run, ok := st.LastJobRun(def.Name); ok {
+				rv := newJobRunView(run)
+				v.LastRun = &rv
+			}
+			out = append(out, v)
+		}
+
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func handleJobRuns(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if _, ok := job.Lookup(name); !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Unknown job " + name,
+			})
+		}
+
+		limit := 20
+		if raw := c.QueryParam("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "limit must be a positive integer",
+				})
+			}
+			limit = n
+		}
+
+		runs := st.JobRuns(name, limit)
+		out := make([]jobRunView, 0, len(runs))
+		for _, run := range runs {
+			out = append(out, newJobRunView(run))
+		}
+
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func newJobRunView(run store.JobRun) jobRunView {
+	return jobRunView{
+		Job:             run.Job,
+		Trigger:         run.Trigger,
+		StartedAt:       run.StartedAt,
+		DurationSeconds: run.Duration.Seconds(),
+		Outcome:         run.Outcome,
+		Error:           run.Error,
+	}
+}
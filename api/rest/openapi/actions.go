@@ -0,0 +1,29 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+func Docs(l *zerolog.Logger, e *echo.Echo) {
+	logger := l.With().Str("type", "openapi").Logger()
+
+	spec, err := Build()
+	if err != nil {
+		logger.Err(err).Msg("Failed to build OpenAPI document")
+		return
+	}
+
+	e.GET("/api/openapi.json", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, spec)
+	})
+	e.GET("/api/docs", func(c echo.Context) error {
+		return c.HTMLBlob(http.StatusOK, docsPage)
+	})
+}
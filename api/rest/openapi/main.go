@@ -0,0 +1,10 @@
+package openapi
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+func REST(l *zerolog.Logger, e *echo.Echo) {
+	Docs(l, e)
+}
@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var base []byte
+
+// Build returns the OpenAPI document with the trigger routes and job names
+// of the registry filled in, so it follows the jobs compiled into the binary.
+func Build() ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi.json: %w", err)
+	}
+
+	paths := doc["paths"].(map[string]any)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var names []string
+	for _, def := range job.Definitions() {
+		names = append(names, def.Name)
+		if def.Route == "" {
+			continue
+		}
+		paths[def.Route] = map[string]any{
+			"post": triggerOperation(def, false),
+			"get":  triggerOperation(def, true),
+		}
+	}
+	sort.Strings(names)
+	schemas["JobName"].(map[string]any)["enum"] = names
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func triggerOperation(def job.Definition, deprecated bool) map[string]any {
+	op := map[string]any{
+		"tags":        []string{"jobs"},
+		"summary":     "Start " + def.Title,
+		"description": def.Description + ". The result is sent to Telegram.",
+		"x-scope":     "trigger",
+		"responses": map[string]any{
+			"202": map[string]any{
+				"description": "Job started",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{"$ref": "#/components/schemas/Message"},
+					},
+				},
+			},
+			"401": map[string]any{"$ref": "#/components/responses/Unauthorized"},
+			"403": map[string]any{"$ref": "#/components/responses/Forbidden"},
+			"429": map[string]any{"$ref": "#/components/responses/Busy"},
+			"503": map[string]any{"$ref": "#/components/responses/ShuttingDown"},
+		},
+	}
+	if deprecated {
+		op["deprecated"] = true
+		op["description"] = "Use POST instead; GET is kept for old clients."
+	}
+	return op
+}
+
+// Missing lists the routes registered on e that the document does not
+// describe, as "METHOD /path".
+func Missing(e *echo.Echo) ([]string, error) {
+	spec, err := Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+
+	// OpenAPI treats paths differing only in parameter names as one path,
+	// so routes are matched on their shape
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+pathShape(path)] = true
+		}
+	}
+
+	var missing []string
+	for _, r := range e.Routes() {
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			continue
+		}
+		if !documented[r.Method+" "+pathShape(r.Path)] {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// pathShape replaces the parameters of an Echo path such as /jobs/:name/runs
+// or an OpenAPI path such as /jobs/{name}/runs with {}.
+func pathShape(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "{") {
+			parts[i] = "{}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
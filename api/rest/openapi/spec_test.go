@@ -0,0 +1,35 @@
+package openapi_test
+
+import (
+	"testing"
+
+	"github.com/koss-shtukert/servers-stats/api"
+	"github.com/koss-shtukert/servers-stats/api/rest/openapi"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/health"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+func TestSpecCoversEveryRoute(t *testing.T) {
+	l := zerolog.Nop()
+	live := config.NewLive(&config.Config{})
+	ev := events.New()
+	st, err := store.New(&l, t.TempDir(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := job.NewExecutor(&l, live, st, ev)
+
+	s := api.CreateServer(&l, live, nil, st, ex, ev, health.NewChecker(live, nil, nil, st, ex))
+
+	missing, err := openapi.Missing(s.Echo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range missing {
+		t.Errorf("route %s is not in openapi.json", r)
+	}
+}
@@ -0,0 +1,38 @@
+package probes
+
+import (
+	"net/http"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/health"
+	"github.com/labstack/echo/v4"
+)
+
+// Probes are public for container healthchecks; component messages and
+// details, which include paths and errors, need a token with read scope.
+func Probes(e *echo.Echo, h *health.Checker) {
+	e.GET("/livez", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{
+			"status": health.StatusOK,
+		})
+	})
+	e.GET("/readyz", handleReady(h))
+}
+
+func handleReady(h *health.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := h.Check()
+
+		if !auth.HasScope(c, auth.ScopeRead) {
+			for name, comp := range report.Components {
+				report.Components[name] = health.Component{Status: comp.Status}
+			}
+		}
+
+		code := http.StatusOK
+		if report.Status == health.StatusFail {
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, report)
+	}
+}
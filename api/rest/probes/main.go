@@ -0,0 +1,10 @@
+package probes
+
+import (
+	"github.com/koss-shtukert/servers-stats/health"
+	"github.com/labstack/echo/v4"
+)
+
+func REST(e *echo.Echo, h *health.Checker) {
+	Probes(e, h)
+}
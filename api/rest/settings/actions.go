@@ -0,0 +1,30 @@
+package settings
+
+import (
+	"net/http"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/labstack/echo/v4"
+)
+
+type settingsView struct {
+	File     string           `json:"file"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// Settings serves the effective config with the source of each value.
+// Secrets are redacted, but the rest may still be sensitive, hence admin.
+func Settings(e *echo.Echo, cfg *config.Live) {
+	e.GET("/api/v1/config", handleSettings(cfg), auth.Require(auth.ScopeAdmin))
+}
+
+func handleSettings(cfg *config.Live) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conf := cfg.Get()
+		return c.JSON(http.StatusOK, settingsView{
+			File:     conf.File(),
+			Settings: conf.Settings(),
+		})
+	}
+}
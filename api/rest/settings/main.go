@@ -0,0 +1,10 @@
+package settings
+
+import (
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/labstack/echo/v4"
+)
+
+func REST(e *echo.Echo, cfg *config.Live) {
+	Settings(e, cfg)
+}
@@ -0,0 +1,78 @@
+package silences
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+)
+
+// maxDuration keeps a forgotten silence from muting a key for good.
+const maxDuration = 30 * 24 * time.Hour
+
+// keyPattern matches the alert keys the store records.
+var keyPattern = regexp.MustCompile(`^(speedtest|disk:[A-Za-z0-9_-]+)$`)
+
+type silenceRequest struct {
+	Key      string `json:"key"`
+	Duration string `json:"duration"`
+	Comment  string `json:"comment"`
+}
+
+func Silences(e *echo.Echo, st *store.Store) {
+	e.GET("/api/v1/silences", handleList(st), auth.Require(auth.ScopeRead))
+	e.POST("/api/v1/silences", handleCreate(st), auth.Require(auth.ScopeTrigger))
+	e.DELETE("/api/v1/silences/:id", handleExpire(st), auth.Require(auth.ScopeTrigger))
+}
+
+func handleList(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		out := st.Silences()
+		if out == nil {
+			out = []store.Silence{}
+		}
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func handleCreate(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req silenceRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request body",
+			})
+		}
+
+		if !keyPattern.MatchString(req.Key) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "key must be speedtest or disk:<name>",
+			})
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 || d > maxDuration {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "duration must be a duration such as 8h, at most 720h",
+			})
+		}
+
+		silence := st.AddSilence(req.Key, strings.TrimSpace(req.Comment), auth.TokenName(c), time.Now().Add(d))
+		return c.JSON(http.StatusCreated, silence)
+	}
+}
+
+func handleExpire(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		silence, ok := st.ExpireSilence(c.Param("id"))
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Unknown or expired silence " + c.Param("id"),
+			})
+		}
+		return c.JSON(http.StatusOK, silence)
+	}
+}
@@ -0,0 +1,10 @@
+package silences
+
+import (
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/labstack/echo/v4"
+)
+
+func REST(e *echo.Echo, st *store.Store) {
+	Silences(e, st)
+}
@@ -2,35 +2,47 @@ package speed_test
 
 import (
 	"net/http"
+	"time"
 
-	"github.com/koss-shtukert/servers-stats/cron/job"
-	"github.com/rs/zerolog"
-
-	"github.com/koss-shtukert/servers-stats/bot"
-	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/labstack/echo/v4"
 )
 
-func SpeedTest(l *zerolog.Logger, e *echo.Echo, cfg *config.Config, b *bot.Bot) {
-	e.GET("/speed-test", handleSpeedTest(l, cfg, b))
+func SpeedTest(e *echo.Echo, st *store.Store) {
+	e.GET("/api/v1/speedtest/latest", handleLatest(st), auth.Require(auth.ScopeRead))
+	e.GET("/api/v1/speedtest/history", handleHistory(st), auth.Require(auth.ScopeRead))
 }
 
-func handleSpeedTest(l *zerolog.Logger, cfg *config.Config, b *bot.Bot) echo.HandlerFunc {
+func handleHistory(st *store.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Use bot's rate limiting mechanism to prevent multiple speedtests
-		if !b.CanExecuteCommand("speedtest") {
-			return c.JSON(http.StatusTooManyRequests, map[string]string{
-				"error": "Speedtest is already running or rate limited",
-			})
+		since := 7 * 24 * time.Hour
+		if raw := c.QueryParam("since"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "since must be a duration such as 168h",
+				})
+			}
+			since = d
 		}
 
-		// Execute speedtest with proper control
-		go b.ExecuteJob("speedtest", func() {
-			job.SpeedTestJob(l, cfg, b)()
-		})
+		samples := st.SpeedTestsSince(time.Now().Add(-since))
+		if samples == nil {
+			samples = []store.SpeedTestSample{}
+		}
+		return c.JSON(http.StatusOK, samples)
+	}
+}
 
-		return c.JSON(http.StatusAccepted, map[string]string{
-			"message": "Speedtest started",
-		})
+func handleLatest(st *store.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sample, ok := st.LatestSpeedTest()
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "No speedtest results yet",
+			})
+		}
+		return c.JSON(http.StatusOK, sample)
 	}
 }
@@ -1,14 +1,33 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
-
-	"github.com/koss-shtukert/servers-stats/api/rest/motioneye_disk_usage"
-	"github.com/koss-shtukert/servers-stats/api/rest/plex_disk_usage"
-	"github.com/koss-shtukert/servers-stats/api/rest/server_disk_usage"
+	"os"
+	"strings"
+
+	"github.com/koss-shtukert/servers-stats/api/auth"
+	"github.com/koss-shtukert/servers-stats/api/rest/alerts"
+	"github.com/koss-shtukert/servers-stats/api/rest/async_jobs"
+	"github.com/koss-shtukert/servers-stats/api/rest/dashboard"
+	"github.com/koss-shtukert/servers-stats/api/rest/disks"
+	"github.com/koss-shtukert/servers-stats/api/rest/event_stream"
+	"github.com/koss-shtukert/servers-stats/api/rest/jobs"
+	"github.com/koss-shtukert/servers-stats/api/rest/openapi"
+	"github.com/koss-shtukert/servers-stats/api/rest/probes"
+	"github.com/koss-shtukert/servers-stats/api/rest/settings"
+	"github.com/koss-shtukert/servers-stats/api/rest/silences"
 	"github.com/koss-shtukert/servers-stats/api/rest/speed_test"
 	"github.com/koss-shtukert/servers-stats/bot"
 	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/health"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,14 +35,19 @@ import (
 )
 
 type Server struct {
-	server *echo.Echo
-	tgBot  *bot.Bot
-	logger *zerolog.Logger
-	config *config.Config
+	server  *echo.Echo
+	http    *http.Server
+	metrics *http.Server
+	tgBot   *bot.Bot
+	logger  *zerolog.Logger
+	config  *config.Live
+	auth    *auth.Authenticator
+	events  *events.Bus
 }
 
-func CreateServer(l *zerolog.Logger, c *config.Config, b *bot.Bot) *Server {
+func CreateServer(l *zerolog.Logger, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor, ev *events.Bus, h *health.Checker) *Server {
 	logger := l.With().Str("type", "server").Logger()
+	c := cfg.Get()
 
 	e := echo.New()
 
@@ -46,7 +70,8 @@ func CreateServer(l *zerolog.Logger, c *config.Config, b *bot.Bot) *Server {
 				Int("status", v.Status).
 				Any("headers", v.Headers).
 				Str("remote_ip", v.RemoteIP).
-				Str("request_id", v.RequestID)
+				Str("request_id", v.RequestID).
+				Str("token", auth.TokenName(c))
 
 			if v.Error == nil {
 				log.Msg("request")
@@ -60,10 +85,13 @@ func CreateServer(l *zerolog.Logger, c *config.Config, b *bot.Bot) *Server {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{"*"},
-		AllowMethods: []string{"GET"},
+		AllowHeaders: []string{echo.HeaderAuthorization, echo.HeaderContentType},
+		AllowMethods: []string{"GET", "POST", "DELETE"},
 	}))
 
+	authenticator := auth.New(l, c.ApiTokens)
+	e.Use(authenticator.Middleware("/healthcheck", "/livez", "/readyz", "/api/openapi.json", "/api/docs", "/", "/assets/:file"))
+
 	e.HideBanner = true
 
 	e.GET("/healthcheck", func(c echo.Context) error {
@@ -72,36 +100,148 @@ func CreateServer(l *zerolog.Logger, c *config.Config, b *bot.Bot) *Server {
 		})
 	})
 
-	// Prometheus metrics endpoint
-	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	// Prometheus metrics endpoint, moved to its own listener if configured
+	errorLog := log.New(logger.With().Str("component", "net/http").Logger(), "", 0)
+
+	var metricsServer *http.Server
+	if c.Http.MetricsListen == "" {
+		e.GET("/metrics", echo.WrapHandler(promhttp.Handler()), auth.Require(auth.ScopeRead))
+	} else {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsServer = &http.Server{
+			Handler:      mux,
+			ErrorLog:     errorLog,
+			ReadTimeout:  c.Http.ReadTimeout,
+			WriteTimeout: c.Http.WriteTimeout,
+			IdleTimeout:  c.Http.IdleTimeout,
+		}
+	}
 
-	motioneye_disk_usage.REST(l, e, c, b)
-	plex_disk_usage.REST(l, e, c, b)
-	server_disk_usage.REST(l, e, c, b)
-	speed_test.REST(l, e, c, b)
+	jobs.REST(l, e, cfg, b, st, ex)
+	async_jobs.REST(l, e, cfg, b, st, ex)
+	disks.REST(e, st)
+	speed_test.REST(e, st)
+	event_stream.REST(l, e, ev)
+	alerts.REST(e, st)
+	silences.REST(e, st)
+	settings.REST(e, cfg)
+	dashboard.REST(e)
+	probes.REST(e, h)
+	openapi.REST(l, e)
 
 	s := &Server{
 		server: e,
-		tgBot:  b,
-		logger: &logger,
-		config: c,
+		http: &http.Server{
+			Handler:      e,
+			ErrorLog:     errorLog,
+			ReadTimeout:  c.Http.ReadTimeout,
+			WriteTimeout: c.Http.WriteTimeout,
+			IdleTimeout:  c.Http.IdleTimeout,
+		},
+		metrics: metricsServer,
+		tgBot:   b,
+		logger:  &logger,
+		config:  cfg,
+		auth:    authenticator,
+		events:  ev,
 	}
 
 	return s
 }
 
+// Echo returns the router with every route registered.
+func (s *Server) Echo() *echo.Echo {
+	return s.server
+}
+
 func (s *Server) Start() error {
-	s.logger.Info().Msg("Starting HTTP server on :1324")
-	if err := s.server.Start(":1324"); err != nil {
+	h := s.config.Get().Http
+
+	if s.metrics != nil {
+		go s.startMetrics(h.MetricsListen)
+	}
+
+	ln, err := listen(h.Listen)
+	if err != nil {
+		s.logger.Err(err).Str("listen", h.Listen).Msg("Failed to start HTTP server")
+		return err
+	}
+
+	if h.TlsCertFile == "" {
+		s.logger.Info().Str("listen", h.Listen).Msg("Starting HTTP server")
+		err = s.http.Serve(ln)
+	} else {
+		s.http.TLSConfig, err = tlsConfig(s.logger, h)
+		if err != nil {
+			ln.Close()
+			s.logger.Err(err).Msg("Failed to configure TLS")
+			return err
+		}
+		s.logger.Info().Str("listen", h.Listen).Bool("client_auth", h.TlsClientCaFile != "").Msg("Starting HTTPS server")
+		err = s.http.ServeTLS(ln, "", "")
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Err(err).Msg("Failed to start HTTP server")
 		return err
 	}
 	return nil
 }
 
-func (s *Server) Shutdown() error {
+func (s *Server) startMetrics(addr string) {
+	ln, err := listen(addr)
+	if err != nil {
+		s.logger.Err(err).Str("listen", addr).Msg("Failed to start metrics server")
+		return
+	}
+
+	s.logger.Info().Str("listen", addr).Msg("Starting metrics server")
+	if err := s.metrics.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Err(err).Msg("Metrics server failed")
+	}
+}
+
+// listen opens addr, either host:port or unix:/path/to/socket.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// A socket left behind by an unclean exit would make Listen fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// Reload applies the API tokens of c. Listener settings need a restart.
+func (s *Server) Reload(c *config.Config) {
+	s.auth.Reload(c.ApiTokens)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info().Msg("Shutting down HTTP server")
-	if err := s.server.Close(); err != nil {
+	// Event streams never finish on their own
+	s.events.Close()
+	if s.metrics != nil {
+		if err := s.metrics.Shutdown(ctx); err != nil {
+			s.logger.Err(err).Msg("Failed to shutdown metrics server")
+		}
+	}
+	if err := s.http.Shutdown(ctx); err != nil {
 		s.logger.Err(err).Msg("Failed to shutdown HTTP server")
 		return err
 	}
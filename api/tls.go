@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/rs/zerolog"
+)
+
+// certCheckInterval limits how often handshakes stat the certificate files.
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves the configured key pair and reloads it when either
+// file changes, so renewed certificates are picked up without a restart.
+type certReloader struct {
+	logger    *zerolog.Logger
+	certFile  string
+	keyFile   string
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(l *zerolog.Logger, certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{logger: l, certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.latestModTime(); err != nil {
+			r.logger.Err(err).Msg("Failed to check TLS certificate, keeping the current one")
+		} else if modTime.After(r.modTime) {
+			if err := r.loadLocked(); err != nil {
+				r.logger.Err(err).Msg("Failed to reload TLS certificate, keeping the current one")
+			} else {
+				r.logger.Info().Str("cert_file", r.certFile).Msg("TLS certificate reloaded")
+			}
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.loadLocked()
+}
+
+func (r *certReloader) loadLocked() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func tlsConfig(l *zerolog.Logger, h config.HttpConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(l, h.TlsCertFile, h.TlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if h.TlsClientCaFile != "" {
+		raw, err := os.ReadFile(h.TlsClientCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificates found in %s", h.TlsClientCaFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
@@ -3,57 +3,102 @@ package bot
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/koss-shtukert/servers-stats/config"
 	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/koss-shtukert/servers-stats/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// maxMessageLength stays under Telegram's 4096 character limit.
+const maxMessageLength = 4000
+
+// outboxSize is how many messages may wait for delivery before senders block.
+const outboxSize = 100
+
+// apiTimeout bounds every Bot API request, above the 30s long poll, so a
+// stalled send can't hold up the outbox.
+const apiTimeout = time.Minute
+
+// outgoing is a message waiting in the outbox. ctx only carries the trace.
+type outgoing struct {
+	ctx    context.Context
+	chatId int64
+	text   string
+}
+
 type Bot struct {
 	tgBot       *tgbotapi.BotAPI
-	chatId      int64
+	chatId      atomic.Int64
+	config      *config.Live
 	logger      *zerolog.Logger
+	store       *store.Store
+	executor    *job.Executor
 	lastCmd     map[string]time.Time
 	cmdMutex    sync.RWMutex
-	running     map[string]bool
-	runMutex    sync.RWMutex
 	lastMessage time.Time
 	msgMutex    sync.Mutex
+	outbox      chan outgoing
+	outboxDone  chan struct{}
+	shutdown    chan struct{}
+	shutdownOne sync.Once
+	queued      atomic.Int64
+	pollCancel  context.CancelFunc
+	pollDone    chan struct{}
+	pollMutex   sync.Mutex
+	pollStarted time.Time
+	lastPoll    time.Time
+	pollErr     error
 }
 
-func CreateBot(c *config.Config, l *zerolog.Logger) (*Bot, error) {
+func CreateBot(cfg *config.Live, l *zerolog.Logger, st *store.Store, ex *job.Executor) (*Bot, error) {
 	logger := l.With().Str("type", "bot").Logger()
+	c := cfg.Get()
 
-	tgBot, err := tgbotapi.NewBotAPI(c.TgBotApiKey)
+	tgBot, err := tgbotapi.NewBotAPIWithClient(c.TgBotApiKey, tgbotapi.APIEndpoint, &http.Client{Timeout: apiTimeout})
 	if err != nil {
 		return nil, fmt.Errorf("error creating bot: %w", err)
 	}
 
-	chatId, err := strconv.ParseInt(c.TgBotChatId, 10, 64)
+	chatId, err := strconv.ParseInt(c.NotifyChatId(), 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid chat id: %w", err)
 	}
 
 	bot := &Bot{
-		tgBot:   tgBot,
-		chatId:  chatId,
-		logger:  &logger,
-		lastCmd: make(map[string]time.Time),
-		running: make(map[string]bool),
+		tgBot:      tgBot,
+		config:     cfg,
+		logger:     &logger,
+		store:      st,
+		executor:   ex,
+		lastCmd:    make(map[string]time.Time),
+		outbox:     make(chan outgoing, outboxSize),
+		outboxDone: make(chan struct{}),
+		shutdown:   make(chan struct{}),
 	}
+	bot.chatId.Store(chatId)
+	go bot.deliver()
 
 	commands := []tgbotapi.BotCommand{
 		{Command: "start", Description: "Hi! Type /help to see available commands."},
 		{Command: "help", Description: "Show help information"},
-		{Command: "server_disk_usage", Description: "Show server disk usage"},
-		{Command: "motioneye_disk_usage", Description: "Show Motioneye disk usage"},
-		{Command: "plex_disk_usage", Description: "Show Plex disk usage"},
-		{Command: "speedtest", Description: "Run speed test"},
+		{Command: "jobs", Description: "Show job schedule and last runs"},
+		{Command: "config", Description: "Show the effective config (admins only)"},
+	}
+	for _, def := range job.Definitions() {
+		if def.Command {
+			commands = append(commands, tgbotapi.BotCommand{Command: def.Name, Description: def.Description})
+		}
 	}
 	if _, err := tgBot.Request(tgbotapi.NewSetMyCommands(commands...)); err != nil {
 		logger.Err(err).Msg("Bot SetMyCommands error")
@@ -62,8 +107,17 @@ func CreateBot(c *config.Config, l *zerolog.Logger) (*Bot, error) {
 	return bot, nil
 }
 
-func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Config) {
+func (b *Bot) StartPolling(l *zerolog.Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.pollCancel = cancel
+	b.pollDone = make(chan struct{})
+	b.pollMutex.Lock()
+	b.pollStarted = time.Now()
+	b.pollMutex.Unlock()
+
 	go func() {
+		defer close(b.pollDone)
+
 		offset := 0
 		networkBackoff := 30 * time.Second
 		maxNetworkBackoff := 5 * time.Minute
@@ -78,6 +132,7 @@ func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Con
 				u.Timeout = 30
 
 				updates, err := b.tgBot.GetUpdates(u)
+				b.recordPoll(err)
 				if err != nil {
 					b.logger.Err(err).Msg("Failed to get updates")
 
@@ -85,7 +140,7 @@ func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Con
 					if strings.Contains(err.Error(), "lookup") || strings.Contains(err.Error(), "dial tcp") || strings.Contains(err.Error(), "i/o timeout") {
 						// DNS or network issues - exponential backoff
 						b.logger.Warn().Dur("backoff", networkBackoff).Msg("Network/DNS issue, backing off")
-						time.Sleep(networkBackoff)
+						sleep(ctx, networkBackoff)
 						networkBackoff = networkBackoff * 2
 						if networkBackoff > maxNetworkBackoff {
 							networkBackoff = maxNetworkBackoff
@@ -93,7 +148,7 @@ func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Con
 					} else {
 						// Other errors - reset network backoff
 						networkBackoff = 30 * time.Second
-						time.Sleep(5 * time.Second)
+						sleep(ctx, 5*time.Second)
 					}
 					continue
 				}
@@ -102,7 +157,7 @@ func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Con
 				networkBackoff = 30 * time.Second
 
 				for _, update := range updates {
-					b.handleUpdate(update, l, c)
+					b.handleUpdate(update, l)
 					offset = update.UpdateID + 1
 				}
 			}
@@ -110,90 +165,249 @@ func (b *Bot) StartPolling(ctx context.Context, l *zerolog.Logger, c *config.Con
 	}()
 }
 
-func (b *Bot) handleUpdate(update tgbotapi.Update, l *zerolog.Logger, c *config.Config) {
+func (b *Bot) handleUpdate(update tgbotapi.Update, l *zerolog.Logger) {
 	if update.Message == nil || !update.Message.IsCommand() {
 		return
 	}
+	c := b.config.Get()
 
 	switch update.Message.Command() {
 	case "start":
 		b.SendMessage("Hi! Type /help to see available commands.")
 
+	case "jobs":
+		b.SendMessage(b.formatJobs(c))
+
+	case "config":
+		// Sent privately, the configured chat may be a group
+		from := update.Message.From
+		if from == nil || !slices.Contains(c.TgBotAdminUserIds, from.ID) {
+			b.SendMessage("⚠️ /config is limited to tgbot_admin_user_ids")
+			return
+		}
+		for _, part := range splitMessage(formatConfig(c), maxMessageLength) {
+			b.SendMessageTo(from.ID, part)
+		}
+
 	case "help":
 		msg := "Available commands:\n" +
-			"/server_disk_usage — Server disk usage\n" +
-			"/motioneye_disk_usage — Motioneye disk usage\n" +
-			"/plex_disk_usage — Plex disk usage\n" +
-			"/speedtest — Run speedtest\n"
+			"/jobs — Job schedule and last runs\n" +
+			"/config — Effective config (admins only)\n"
+		for _, def := range job.Definitions() {
+			if def.Command {
+				msg += fmt.Sprintf("/%s — %s\n", def.Name, def.Description)
+			}
+		}
 		b.SendMessage(msg)
 
-	case "server_disk_usage":
-		if b.CanExecuteCommand("server_disk_usage") {
-			go b.ExecuteJob("server_disk_usage", func() {
-				job.ServerDiskUsageJob(l, c, b)()
-			})
-		} else {
-			b.SendMessage("⚠️ Please wait before running this command again")
+	default:
+		def, ok := job.Lookup(update.Message.Command())
+		if !ok || !def.Command {
+			b.SendMessage("Unknown command. Try /help")
+			return
 		}
 
-	case "motioneye_disk_usage":
-		if b.CanExecuteCommand("motioneye_disk_usage") {
-			go b.ExecuteJob("motioneye_disk_usage", func() {
-				job.MotioneyeDiskUsageJob(l, c, b)()
-			})
-		} else {
-			b.SendMessage("⚠️ Please wait before running this command again")
+		if b.executor.Closed() {
+			b.SendMessage("⚠️ Shutting down, try again later")
+			return
 		}
 
-	case "plex_disk_usage":
-		if b.CanExecuteCommand("plex_disk_usage") {
-			go b.ExecuteJob("plex_disk_usage", func() {
-				job.PlexDiskUsageJob(l, c, b)()
-			})
-		} else {
+		if !b.CanExecuteCommand(def) {
 			b.SendMessage("⚠️ Please wait before running this command again")
+			return
 		}
 
-	case "speedtest":
-		if b.CanExecuteCommand("speedtest") {
-			b.SendMessage("Running speedtest…")
-			go b.ExecuteJob("speedtest", func() {
-				job.SpeedTestJob(l, c, b)()
-			})
-		} else {
-			b.SendMessage("⚠️ Speedtest is already running or please wait")
+		if def.StartMessage != "" {
+			b.SendMessage(def.StartMessage)
 		}
+		go b.ExecuteJob(def, job.Deps{
+			Logger:   l,
+			Config:   c,
+			Store:    b.store,
+			Notifier: b,
+			Trigger:  job.TriggerBot,
+		})
+	}
+}
 
-	default:
-		b.SendMessage("Unknown command. Try /help")
+// StopPolling stops fetching updates and waits for the poller to exit. A
+// long poll in progress can't be interrupted, so this may return ctx.Err().
+func (b *Bot) StopPolling(ctx context.Context) error {
+	if b.pollCancel == nil {
+		return nil
+	}
+	b.pollCancel()
+
+	select {
+	case <-b.pollDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain stops accepting messages and waits until every queued message is
+// sent. Messages still queued when ctx ends are logged and dropped.
+func (b *Bot) Drain(ctx context.Context) error {
+	b.shutdownOne.Do(func() { close(b.shutdown) })
+
+	select {
+	case <-b.outboxDone:
+		return nil
+	case <-ctx.Done():
+	}
+
+	queued := b.queued.Load()
+	for {
+		select {
+		case msg := <-b.outbox:
+			b.queued.Add(-1)
+			b.logger.Warn().Int64("chat_id", msg.chatId).Str("text", preview(msg.text)).Msg("Message not sent before shutdown")
+		default:
+			return fmt.Errorf("%d message(s) not sent: %w", queued, ctx.Err())
+		}
+	}
+}
+
+func (b *Bot) recordPoll(err error) {
+	b.pollMutex.Lock()
+	defer b.pollMutex.Unlock()
+
+	b.pollErr = err
+	if err == nil {
+		b.lastPoll = time.Now()
+	}
+}
+
+// Reload applies the bot settings of c. The API key can't change without a
+// restart.
+func (b *Bot) Reload(c *config.Config) error {
+	chatId, err := strconv.ParseInt(c.NotifyChatId(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat id: %w", err)
+	}
+	b.chatId.Store(chatId)
+	return nil
+}
+
+// PollStatus reports when polling started, when it last succeeded and the
+// error of the latest attempt, if it failed.
+func (b *Bot) PollStatus() (started, lastSuccess time.Time, err error) {
+	b.pollMutex.Lock()
+	defer b.pollMutex.Unlock()
+
+	return b.pollStarted, b.lastPoll, b.pollErr
+}
+
+// Queued returns the number of messages in the outbox, including the one
+// being sent.
+func (b *Bot) Queued() int64 {
+	return b.queued.Load()
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
 	}
 }
 
 func (b *Bot) SendMessage(m string) {
-	msg := tgbotapi.NewMessage(b.chatId, m)
-	if _, err := b.tgBot.Send(msg); err != nil {
-		b.logger.Err(err).Msg("Failed to send message")
+	b.SendMessageContext(context.Background(), m)
+}
+
+func (b *Bot) SendMessageTo(chatId int64, m string) {
+	b.SendMessageToContext(context.Background(), chatId, m)
+}
+
+// SendMessageContext queues m for the configured chat, traced as part of ctx.
+func (b *Bot) SendMessageContext(ctx context.Context, m string) {
+	b.enqueue(outgoing{ctx: ctx, chatId: b.chatId.Load(), text: m})
+}
+
+func (b *Bot) SendMessageToContext(ctx context.Context, chatId int64, m string) {
+	b.enqueue(outgoing{ctx: ctx, chatId: chatId, text: m})
+}
+
+// enqueue adds msg to the outbox, blocking while it is full until Drain is
+// called or msg.ctx ends, which drop the message.
+func (b *Bot) enqueue(msg outgoing) {
+	logger := b.logger.With().Int64("chat_id", msg.chatId).Str("text", preview(msg.text)).Logger()
+
+	select {
+	case <-b.shutdown:
+		logger.Warn().Msg("Shutting down, dropping message")
+		return
+	default:
+	}
+
+	b.queued.Add(1)
+	select {
+	case b.outbox <- msg:
+	case <-b.shutdown:
+		b.queued.Add(-1)
+		logger.Warn().Msg("Shutting down, dropping message")
+	case <-msg.ctx.Done():
+		b.queued.Add(-1)
+		logger.Warn().Err(msg.ctx.Err()).Msg("Outbox full, dropping message")
 	}
 }
 
-func (b *Bot) CanExecuteCommand(cmd string) bool {
+// deliver sends the outbox in order. Once Drain is called it sends what is
+// queued and returns.
+func (b *Bot) deliver() {
+	defer close(b.outboxDone)
+
+	for {
+		select {
+		case msg := <-b.outbox:
+			b.send(msg)
+		case <-b.shutdown:
+			for {
+				select {
+				case msg := <-b.outbox:
+					b.send(msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Bot) send(msg outgoing) {
+	_, span := tracing.Start(msg.ctx, "telegram.send", attribute.Int64("chat_id", msg.chatId))
+	_, err := b.tgBot.Send(tgbotapi.NewMessage(msg.chatId, msg.text))
+	tracing.End(span, err)
+	b.queued.Add(-1)
+
+	if err != nil {
+		b.logger.Err(err).Int64("chat_id", msg.chatId).Msg("Failed to send message")
+	}
+}
+
+// preview shortens m for logs.
+func preview(m string) string {
+	if r := []rune(m); len(r) > 80 {
+		return string(r[:80]) + "…"
+	}
+	return m
+}
+
+func (b *Bot) CanExecuteCommand(def job.Definition) bool {
 	b.cmdMutex.RLock()
-	lastTime, exists := b.lastCmd[cmd]
+	lastTime, exists := b.lastCmd[def.Name]
 	b.cmdMutex.RUnlock()
 
-	b.runMutex.RLock()
-	isRunning := b.running[cmd]
-	b.runMutex.RUnlock()
-
-	// Check if command is already running
-	if isRunning {
+	// Check if the job is already running (and not queueable)
+	if b.executor.Busy(def) {
 		return false
 	}
 
-	// Rate limiting: 30 seconds for speedtest, 10 seconds for others
+	// Rate limiting: jobs may declare their own cooldown, 10 seconds otherwise
 	cooldown := 10 * time.Second
-	if cmd == "speedtest" {
-		cooldown = 30 * time.Second
+	if def.Cooldown > 0 {
+		cooldown = def.Cooldown
 	}
 
 	if exists && time.Since(lastTime) < cooldown {
@@ -203,22 +417,82 @@ func (b *Bot) CanExecuteCommand(cmd string) bool {
 	return true
 }
 
-func (b *Bot) ExecuteJob(cmd string, jobFunc func()) {
-	// Mark as running
-	b.runMutex.Lock()
-	b.running[cmd] = true
-	b.runMutex.Unlock()
-
+func (b *Bot) ExecuteJob(def job.Definition, d job.Deps) job.RunResult {
 	// Update last execution time
 	b.cmdMutex.Lock()
-	b.lastCmd[cmd] = time.Now()
+	b.lastCmd[def.Name] = time.Now()
 	b.cmdMutex.Unlock()
 
-	// Execute job
-	jobFunc()
+	// Execute job through the shared guard
+	return b.executor.Run(context.Background(), def, d)
+}
+
+func formatConfig(c *config.Config) string {
+	var sb strings.Builder
+	sb.WriteString("⚙️ Effective config")
+	if c.File() != "" {
+		fmt.Fprintf(&sb, " (%s)", c.File())
+	}
+	sb.WriteString("\n")
+
+	for _, s := range c.Settings() {
+		source := s.Source
+		if s.Origin != "" {
+			source += " " + s.Origin
+		}
+		fmt.Fprintf(&sb, "• %s = %s [%s]\n", s.Key, s.ValueString(), source)
+	}
+	return sb.String()
+}
+
+// splitMessage cuts m at line breaks into parts of at most limit bytes.
+func splitMessage(m string, limit int) []string {
+	var parts []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(m, "\n") {
+		if current.Len()+len(line) > limit && current.Len() > 0 {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+func (b *Bot) formatJobs(c *config.Config) string {
+	var sb strings.Builder
+	sb.WriteString("🗂 Jobs\n")
+
+	for _, def := range job.Definitions() {
+		schedule := "manual"
+		if def.Schedule != nil {
+			schedule = "disabled"
+			if def.Enabled(c) {
+				schedule = def.Schedule(c)
+			}
+		}
+
+		last := "never run"
+		if run, ok := b.store.LastJobRun(def.Name); ok {
+			icon := "✅"
+			if run.Outcome != job.OutcomeSuccess {
+				icon = "❌"
+			}
+			last = fmt.Sprintf("%s %s %s ago (%s, %s)", icon, run.Outcome, time.Since(run.StartedAt).Round(time.Second), run.Duration.Round(time.Millisecond), run.Trigger)
+			if run.Error != "" {
+				last += " — " + run.Error
+			}
+		}
+
+		if b.executor.Running(def.Name) {
+			last = "⏳ running, " + last
+		}
+
+		fmt.Fprintf(&sb, "• %s [%s]: %s\n", def.Name, schedule, last)
+	}
 
-	// Mark as finished
-	b.runMutex.Lock()
-	b.running[cmd] = false
-	b.runMutex.Unlock()
+	return sb.String()
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/logger"
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+// Nagios plugin exit codes
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+func validFormat(format string) bool {
+	if format == formatTable || format == formatJSON {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Invalid --format %q, expected table or json\n", format)
+	return false
+}
+
+func nagiosCode(status string) int {
+	switch status {
+	case common.StatusOK:
+		return nagiosOK
+	case common.StatusWarning:
+		return nagiosWarning
+	case common.StatusCritical:
+		return nagiosCritical
+	}
+	return nagiosUnknown
+}
+
+// check runs a single check without the daemon or Telegram and prints its
+// result, exiting with the Nagios code of the worst status.
+func check(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "check needs a target: disk or speedtest\n\n%s", usage)
+		return nagiosUnknown
+	}
+
+	switch args[0] {
+	case "disk":
+		return checkDisk(args[1:])
+	case "speedtest":
+		return checkSpeedTest(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "Unknown check %q, expected disk or speedtest\n", args[0])
+	return nagiosUnknown
+}
+
+type diskCheck struct {
+	*common.DiskUsageResult
+	Status string `json:"status"`
+}
+
+func checkDisk(args []string) int {
+	fs := flag.NewFlagSet("check disk", flag.ExitOnError)
+	logLevel := fs.String("log-level", "warn", "log level")
+	format := fs.String("format", formatTable, "output format: table or json")
+	warn := fs.Int("warn", common.DefaultDiskWarnPercent, "usage percentage from which a disk is WARNING")
+	crit := fs.Int("crit", common.DefaultDiskCritPercent, "usage percentage from which a disk is CRITICAL")
+	paths := parseArgs(fs, args)
+	if !validFormat(*format) {
+		return nagiosUnknown
+	}
+
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: servers-stats check disk <path>... [--warn 70] [--crit 90] [--format table|json]")
+		return nagiosUnknown
+	}
+	if *warn < 1 || *crit > 100 || *warn >= *crit {
+		fmt.Fprintf(os.Stderr, "Invalid thresholds --warn %d --crit %d, expected 1 <= warn < crit <= 100\n", *warn, *crit)
+		return nagiosUnknown
+	}
+	common.SetDiskThresholds(*warn, *crit)
+
+	logr, err := logger.NewConsole(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Logger error:", err)
+		return nagiosUnknown
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	code := nagiosOK
+	results := []diskCheck{}
+	for _, path := range paths {
+		result, err := common.GetDiskUsage(ctx, &logr, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			code = max(code, nagiosUnknown)
+			continue
+		}
+
+		status := common.DiskUsageStatus(result.Percentage)
+		code = max(code, nagiosCode(status))
+		results = append(results, diskCheck{DiskUsageResult: result, Status: status})
+	}
+
+	if *format == formatJSON {
+		printJSON(results)
+		return code
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tUSED\tAVAILABLE\tUSAGE\tINODES\tSTATUS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d%%\t%s\n", r.Path, r.Used, r.Available, r.UsageStr, r.InodesPercent, r.Status)
+	}
+	w.Flush()
+	return code
+}
+
+var speedTestKeys = []string{
+	"data_dir",
+	"cron_speed_test_job_exp_down",
+	"cron_speed_test_job_exp_up",
+	"cron_speed_test_job_warn_pct",
+	"cron_speed_test_job_crit_pct",
+	"cron_speed_test_job_warn_lat",
+	"cron_speed_test_job_crit_lat",
+}
+
+func checkSpeedTest(args []string) int {
+	fs := flag.NewFlagSet("check speedtest", flag.ExitOnError)
+	configPath, logLevel := commonFlags(fs)
+	format := fs.String("format", formatTable, "output format: table or json")
+	fs.Parse(args)
+	if !validFormat(*format) {
+		return nagiosUnknown
+	}
+
+	// Thresholds and the history directory come from the config, the
+	// Telegram settings the daemon needs don't matter here
+	cfg, err := config.LoadKeys(*configPath, speedTestKeys...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Config error:", err)
+		return nagiosUnknown
+	}
+	if cfg.CronSpeedTestJobExpDown <= 0 || cfg.CronSpeedTestJobExpUp <= 0 {
+		fmt.Fprintln(os.Stderr, "Config error: cron_speed_test_job_exp_down and cron_speed_test_job_exp_up are required to rate the result")
+		return nagiosUnknown
+	}
+	if *logLevel == "" {
+		*logLevel = "warn"
+	}
+
+	logr, err := logger.NewConsole(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Logger error:", err)
+		return nagiosUnknown
+	}
+	logger.SetSecrets(cfg.Secrets())
+
+	st, err := store.NewReadOnly(&logr, cfg.DataDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Store error:", err)
+		return nagiosUnknown
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	sample, err := job.SpeedTestJob(&logr, cfg, st, common.LogNotifier{Logger: &logr}, nil, false)(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Speedtest failed:", err)
+		return nagiosUnknown
+	}
+
+	if *format == formatJSON {
+		printJSON(sample)
+		return nagiosCode(sample.Status)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOWNLOAD\tUPLOAD\tPING\tISP\tSERVER\tSTATUS")
+	fmt.Fprintf(w, "%.2f Mbps\t%.2f Mbps\t%.1f ms\t%s\t%s\t%s\n", sample.DownloadMbps, sample.UploadMbps, sample.PingMs, sample.ISP, sample.Server, sample.Status)
+	w.Flush()
+	return nagiosCode(sample.Status)
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -1,5 +1,66 @@
 package common
 
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
 type Notifier interface {
 	SendMessage(m string)
 }
+
+type LogNotifier struct {
+	Logger *zerolog.Logger
+}
+
+func (n LogNotifier) SendMessage(m string) {
+	n.Logger.Info().Str("message", m).Msg("Notification")
+}
+
+type ChatNotifier interface {
+	Notifier
+	SendMessageTo(chatId int64, m string)
+}
+
+type chatNotifier struct {
+	notifier ChatNotifier
+	chatId   int64
+}
+
+func ChatNotifierFor(n ChatNotifier, chatId int64) Notifier {
+	return chatNotifier{notifier: n, chatId: chatId}
+}
+
+func (n chatNotifier) SendMessage(m string) {
+	n.notifier.SendMessageTo(n.chatId, m)
+}
+
+// ContextNotifier is a ChatNotifier whose sends can join the trace of ctx.
+type ContextNotifier interface {
+	ChatNotifier
+	SendMessageContext(ctx context.Context, m string)
+	SendMessageToContext(ctx context.Context, chatId int64, m string)
+}
+
+type contextNotifier struct {
+	notifier ContextNotifier
+	ctx      context.Context
+}
+
+// NotifierWithContext returns n sending under ctx when it supports that,
+// otherwise n itself.
+func NotifierWithContext(ctx context.Context, n Notifier) Notifier {
+	if cn, ok := n.(ContextNotifier); ok {
+		return contextNotifier{notifier: cn, ctx: ctx}
+	}
+	return n
+}
+
+func (n contextNotifier) SendMessage(m string) {
+	n.notifier.SendMessageContext(n.ctx, m)
+}
+
+func (n contextNotifier) SendMessageTo(chatId int64, m string) {
+	n.notifier.SendMessageToContext(n.ctx, chatId, m)
+}
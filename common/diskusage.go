@@ -9,28 +9,38 @@ import (
 	"strings"
 	"time"
 
+	"github.com/koss-shtukert/servers-stats/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type DiskUsageResult struct {
-	Used       string
-	Available  string
-	UsageStr   string
-	Percentage int
-	UsedBytes  float64
-	AvailBytes float64
+	Path       string  `json:"path"`
+	Used       string  `json:"used"`
+	Available  string  `json:"available"`
+	UsageStr   string  `json:"usage"`
+	Percentage int     `json:"percentage"`
+	UsedBytes  float64 `json:"used_bytes"`
+	AvailBytes float64 `json:"avail_bytes"`
+	// Inode counters come from statfs and stay zero where it's unavailable
+	InodesTotal   uint64 `json:"inodes_total"`
+	InodesUsed    uint64 `json:"inodes_used"`
+	InodesFree    uint64 `json:"inodes_free"`
+	InodesPercent int    `json:"inodes_percent"`
 }
 
-func GetDiskUsage(logger *zerolog.Logger, path string) (*DiskUsageResult, error) {
+func GetDiskUsage(ctx context.Context, logger *zerolog.Logger, path string) (*DiskUsageResult, error) {
 	cleanPath := filepath.Clean(path)
 	if cleanPath == "." || cleanPath == "" {
 		return nil, fmt.Errorf("invalid path provided: %s", path)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "df", "-h", cleanPath)
+	// df stuck on a hung mount may ignore the kill; don't wait on it forever
+	cmd.WaitDelay = 5 * time.Second
 	logger.Debug().Str("command", "df -h").Str("path", cleanPath).Msg("Executing disk usage command")
 
 	var out, stderr bytes.Buffer
@@ -38,7 +48,10 @@ func GetDiskUsage(logger *zerolog.Logger, path string) (*DiskUsageResult, error)
 	cmd.Stderr = &stderr
 
 	start := time.Now()
-	if err := cmd.Run(); err != nil {
+	_, span := tracing.Start(ctx, "df", attribute.String("path", cleanPath))
+	err := cmd.Run()
+	tracing.End(span, err)
+	if err != nil {
 		logger.Err(err).Str("stderr", stderr.String()).Str("path", cleanPath).Dur("duration", time.Since(start)).Msg("Failed to execute df")
 		return nil, fmt.Errorf("failed to execute df: %w", err)
 	}
@@ -78,14 +91,17 @@ func GetDiskUsage(logger *zerolog.Logger, path string) (*DiskUsageResult, error)
 					return nil, fmt.Errorf("failed to parse available size: %w", err)
 				}
 
-				return &DiskUsageResult{
+				result := &DiskUsageResult{
+					Path:       cleanPath,
 					Used:       used,
 					Available:  avail,
 					UsageStr:   usageStr,
 					Percentage: percent,
 					UsedBytes:  usedBytes,
 					AvailBytes: availBytes,
-				}, nil
+				}
+				addInodeUsage(logger, result)
+				return result, nil
 			} else if len(fields) >= 6 {
 				// Single line format: filesystem, size, used, avail, use%, mount
 				used := fields[len(fields)-4]
@@ -110,14 +126,17 @@ func GetDiskUsage(logger *zerolog.Logger, path string) (*DiskUsageResult, error)
 					return nil, fmt.Errorf("failed to parse available size: %w", err)
 				}
 
-				return &DiskUsageResult{
+				result := &DiskUsageResult{
+					Path:       cleanPath,
 					Used:       used,
 					Available:  avail,
 					UsageStr:   usageStr,
 					Percentage: percent,
 					UsedBytes:  usedBytes,
 					AvailBytes: availBytes,
-				}, nil
+				}
+				addInodeUsage(logger, result)
+				return result, nil
 			}
 		}
 	}
@@ -126,11 +145,27 @@ func GetDiskUsage(logger *zerolog.Logger, path string) (*DiskUsageResult, error)
 	return nil, fmt.Errorf("could not parse disk usage from df output")
 }
 
+func addInodeUsage(logger *zerolog.Logger, r *DiskUsageResult) {
+	total, free, err := inodeUsage(r.Path)
+	if err != nil {
+		logger.Warn().Err(err).Str("path", r.Path).Msg("Failed to read inode usage")
+		return
+	}
+
+	r.InodesTotal = total
+	r.InodesFree = free
+	r.InodesUsed = total - free
+	if total > 0 {
+		r.InodesPercent = int(r.InodesUsed * 100 / total)
+	}
+}
+
 func FormatDiskUsageMessage(serviceName, used, avail, usageStr string, percent int) string {
 	status := "🟢 OK"
-	if percent >= 90 {
+	switch DiskUsageStatus(percent) {
+	case StatusCritical:
 		status = "🔴 CRITICAL"
-	} else if percent >= 70 {
+	case StatusWarning:
 		status = "🟡 Warning"
 	}
 
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package common
+
+import "errors"
+
+func inodeUsage(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("inode usage is not supported on this platform")
+}
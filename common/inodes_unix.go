@@ -0,0 +1,13 @@
+//go:build linux || darwin
+
+package common
+
+import "syscall"
+
+func inodeUsage(path string) (total, free uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	return uint64(fs.Files), uint64(fs.Ffree), nil
+}
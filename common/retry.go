@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	firstBackoff = time.Second
+	maxBackoff   = 30 * time.Second
+)
+
+// PermanentError marks a failure retrying won't fix, such as an HTTP 400.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func Permanent(err error) error {
+	return PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Retry calls fn until it succeeds, fails permanently or has been retried
+// retries times, backing off exponentially, and returns the number of
+// attempts made.
+func Retry(ctx context.Context, retries int, fn func() error) (int, error) {
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || IsPermanent(err) || attempt > retries {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
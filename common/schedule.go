@@ -0,0 +1,13 @@
+package common
+
+import "github.com/robfig/cron/v3"
+
+// ScheduleParser accepts classic five-field expressions, six-field ones with
+// a leading seconds field, and descriptors such as @daily or @every 5m.
+var ScheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	return ScheduleParser.Parse(spec)
+}
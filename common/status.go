@@ -0,0 +1,43 @@
+package common
+
+import "sync/atomic"
+
+const (
+	StatusOK       = "ok"
+	StatusWarning  = "warning"
+	StatusCritical = "critical"
+)
+
+// Disk usage percentages from which DiskUsageStatus reports warning and
+// critical until SetDiskThresholds is called.
+const (
+	DefaultDiskWarnPercent = 70
+	DefaultDiskCritPercent = 90
+)
+
+type diskThresholds struct {
+	warn, crit int
+}
+
+var thresholds atomic.Pointer[diskThresholds]
+
+func init() {
+	SetDiskThresholds(DefaultDiskWarnPercent, DefaultDiskCritPercent)
+}
+
+// SetDiskThresholds sets the usage percentages from which DiskUsageStatus
+// reports warning and critical.
+func SetDiskThresholds(warn, crit int) {
+	thresholds.Store(&diskThresholds{warn: warn, crit: crit})
+}
+
+func DiskUsageStatus(percent int) string {
+	t := thresholds.Load()
+	if percent >= t.crit {
+		return StatusCritical
+	}
+	if percent >= t.warn {
+		return StatusWarning
+	}
+	return StatusOK
+}
@@ -4,41 +4,229 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Environment                       string  `mapstructure:"app_env"`
-	LogLevel                          string  `mapstructure:"log_level"`
-	CronRunMotioneyeDiskUsageJob      bool    `mapstructure:"cron_run_motioneye_disk_usage_job"`
-	CronMotioneyeDiskUsageJobPath     string  `mapstructure:"cron_motioneye_disk_usage_job_path"`
-	CronMotioneyeDiskUsageJobInterval string  `mapstructure:"cron_motioneye_disk_usage_job_interval"`
-	CronRunPlexDiskUsageJob           bool    `mapstructure:"cron_run_plex_disk_usage_job"`
-	CronPlexDiskUsageJobPath          string  `mapstructure:"cron_plex_disk_usage_job_path"`
-	CronPlexDiskUsageJobInterval      string  `mapstructure:"cron_plex_disk_usage_job_interval"`
-	CronRunServerDiskUsageJob         bool    `mapstructure:"cron_run_server_disk_usage_job"`
-	CronServerDiskUsageJobPath        string  `mapstructure:"cron_server_disk_usage_job_path"`
-	CronServerDiskUsageJobInterval    string  `mapstructure:"cron_server_disk_usage_job_interval"`
-	CronRunSpeedTestJob               bool    `mapstructure:"cron_run_speed_test_job"`
-	CronSpeedTestJobInterval          string  `mapstructure:"cron_speed_test_job_interval"`
-	CronSpeedTestJobExpDown           float64 `mapstructure:"cron_speed_test_job_exp_down"`
-	CronSpeedTestJobExpUp             float64 `mapstructure:"cron_speed_test_job_exp_up"`
-	CronSpeedTestJobWarnPct           float64 `mapstructure:"cron_speed_test_job_warn_pct"`
-	CronSpeedTestJobCritPct           float64 `mapstructure:"cron_speed_test_job_crit_pct"`
-	CronSpeedTestJobWarnLat           float64 `mapstructure:"cron_speed_test_job_warn_lat"`
-	CronSpeedTestJobCritLat           float64 `mapstructure:"cron_speed_test_job_crit_lat"`
-	CronRunMotioneyeMetricsJob        bool    `mapstructure:"cron_run_motioneye_metrics_job"`
-	CronMotioneyeMetricsJobInterval   string  `mapstructure:"cron_motioneye_metrics_job_interval"`
-	CronRunServerMetricsJob           bool    `mapstructure:"cron_run_server_metrics_job"`
-	CronServerMetricsJobInterval      string  `mapstructure:"cron_server_metrics_job_interval"`
-	CronRunPlexMetricsJob             bool    `mapstructure:"cron_run_plex_metrics_job"`
-	CronPlexMetricsJobInterval        string  `mapstructure:"cron_plex_metrics_job_interval"`
-	TgBotApiKey                       string  `mapstructure:"tgbot_api_key"`
-	TgBotChatId                       string  `mapstructure:"tgbot_chat_id"`
+	Environment                       string                `mapstructure:"app_env"`
+	LogLevel                          string                `mapstructure:"log_level"`
+	CronRunMotioneyeDiskUsageJob      bool                  `mapstructure:"cron_run_motioneye_disk_usage_job"`
+	CronMotioneyeDiskUsageJobPath     string                `mapstructure:"cron_motioneye_disk_usage_job_path"`
+	CronMotioneyeDiskUsageJobInterval string                `mapstructure:"cron_motioneye_disk_usage_job_interval"`
+	CronRunPlexDiskUsageJob           bool                  `mapstructure:"cron_run_plex_disk_usage_job"`
+	CronPlexDiskUsageJobPath          string                `mapstructure:"cron_plex_disk_usage_job_path"`
+	CronPlexDiskUsageJobInterval      string                `mapstructure:"cron_plex_disk_usage_job_interval"`
+	CronRunServerDiskUsageJob         bool                  `mapstructure:"cron_run_server_disk_usage_job"`
+	CronServerDiskUsageJobPath        string                `mapstructure:"cron_server_disk_usage_job_path"`
+	CronServerDiskUsageJobInterval    string                `mapstructure:"cron_server_disk_usage_job_interval"`
+	DiskWarnPercent                   int                   `mapstructure:"disk_warn_percent"`
+	DiskCritPercent                   int                   `mapstructure:"disk_crit_percent"`
+	CronRunSpeedTestJob               bool                  `mapstructure:"cron_run_speed_test_job"`
+	CronSpeedTestJobInterval          string                `mapstructure:"cron_speed_test_job_interval"`
+	CronSpeedTestJobExpDown           float64               `mapstructure:"cron_speed_test_job_exp_down"`
+	CronSpeedTestJobExpUp             float64               `mapstructure:"cron_speed_test_job_exp_up"`
+	CronSpeedTestJobWarnPct           float64               `mapstructure:"cron_speed_test_job_warn_pct"`
+	CronSpeedTestJobCritPct           float64               `mapstructure:"cron_speed_test_job_crit_pct"`
+	CronSpeedTestJobWarnLat           float64               `mapstructure:"cron_speed_test_job_warn_lat"`
+	CronSpeedTestJobCritLat           float64               `mapstructure:"cron_speed_test_job_crit_lat"`
+	CronRunMotioneyeMetricsJob        bool                  `mapstructure:"cron_run_motioneye_metrics_job"`
+	CronMotioneyeMetricsJobInterval   string                `mapstructure:"cron_motioneye_metrics_job_interval"`
+	CronRunServerMetricsJob           bool                  `mapstructure:"cron_run_server_metrics_job"`
+	CronServerMetricsJobInterval      string                `mapstructure:"cron_server_metrics_job_interval"`
+	CronRunPlexMetricsJob             bool                  `mapstructure:"cron_run_plex_metrics_job"`
+	CronPlexMetricsJobInterval        string                `mapstructure:"cron_plex_metrics_job_interval"`
+	CronRunDailyDigestJob             bool                  `mapstructure:"cron_run_daily_digest_job"`
+	CronDailyDigestJobInterval        string                `mapstructure:"cron_daily_digest_job_interval"`
+	CronRunWeeklyDigestJob            bool                  `mapstructure:"cron_run_weekly_digest_job"`
+	CronWeeklyDigestJobInterval       string                `mapstructure:"cron_weekly_digest_job_interval"`
+	DigestSections                    []string              `mapstructure:"digest_sections"`
+	DigestNotifier                    string                `mapstructure:"digest_notifier"`
+	DigestTgBotChatId                 string                `mapstructure:"digest_tgbot_chat_id"`
+	DigestSuppressOkMessages          bool                  `mapstructure:"digest_suppress_ok_messages"`
+	Jobs                              map[string]JobOptions `mapstructure:"jobs"`
+	DataDir                           string                `mapstructure:"data_dir"`
+	ShutdownTimeout                   time.Duration         `mapstructure:"shutdown_timeout"`
+	CatchUpWindow                     time.Duration         `mapstructure:"catch_up_window"`
+	CatchUpJitter                     time.Duration         `mapstructure:"catch_up_jitter"`
+	ApiTokens                         []ApiToken            `mapstructure:"api_tokens"`
+	Http                              HttpConfig            `mapstructure:"http"`
+	Mqtt                              MqttConfig            `mapstructure:"mqtt"`
+	MetricsPush                       MetricsPushConfig     `mapstructure:"metrics_push"`
+	Influxdb                          InfluxdbConfig        `mapstructure:"influxdb"`
+	Otel                              OtelConfig            `mapstructure:"otel"`
+	TgBotApiKey                       string                `mapstructure:"tgbot_api_key" secret:"true"`
+	TgBotChatId                       string                `mapstructure:"tgbot_chat_id"`
+	TgBotTestChatId                   string                `mapstructure:"tgbot_test_chat_id"`
+	TgBotAdminUserIds                 []int64               `mapstructure:"tgbot_admin_user_ids"`
+
+	// file is the config file that was read, empty when running on
+	// environment variables alone.
+	file     string
+	files    []string
+	warnings []string
+	sources  map[string]origin
+}
+
+func (c *Config) File() string {
+	return c.file
+}
+
+// Files lists every file the config was read from: the base file, its
+// includes and the app_env overlay.
+func (c *Config) Files() []string {
+	return c.files
+}
+
+// Warnings lists settings Load adjusted rather than rejected, such as jobs
+// disabled for lack of a path.
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+type JobOptions struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+	Overlap string        `mapstructure:"overlap"`
+}
+
+// HttpConfig configures the API listener. Listen is host:port or
+// unix:/path/to/socket. TLS is enabled when both cert and key files are set,
+// client certificates are required when TlsClientCaFile is set. With
+// MetricsListen set, /metrics is served there instead of on Listen.
+type HttpConfig struct {
+	Listen          string        `mapstructure:"listen"`
+	TlsCertFile     string        `mapstructure:"tls_cert_file"`
+	TlsKeyFile      string        `mapstructure:"tls_key_file"`
+	TlsClientCaFile string        `mapstructure:"tls_client_ca_file"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	MetricsListen   string        `mapstructure:"metrics_listen"`
+}
+
+// MqttConfig configures publishing to an MQTT broker, disabled while Broker
+// is empty. Topics live under TopicPrefix/NodeId, NodeId defaulting to the
+// hostname. Home Assistant discovery configs go under DiscoveryPrefix,
+// empty to publish none.
+type MqttConfig struct {
+	Broker          string `mapstructure:"broker"`
+	ClientId        string `mapstructure:"client_id"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password" secret:"true"`
+	TopicPrefix     string `mapstructure:"topic_prefix"`
+	DiscoveryPrefix string `mapstructure:"discovery_prefix"`
+	NodeId          string `mapstructure:"node_id"`
+	Qos             int    `mapstructure:"qos"`
+	Retain          bool   `mapstructure:"retain"`
+}
+
+// MetricsPushConfig pushes the metrics registry every Interval to a
+// Pushgateway, a remote-write endpoint or both, for hosts that can't be
+// scraped. Labels group the push and are attached to every remote-write
+// series, instance defaulting to the hostname. A failed push is retried
+// Retries times before waiting for the next interval.
+type MetricsPushConfig struct {
+	PushgatewayUrl string            `mapstructure:"pushgateway_url"`
+	RemoteWriteUrl string            `mapstructure:"remote_write_url"`
+	Interval       time.Duration     `mapstructure:"interval"`
+	Timeout        time.Duration     `mapstructure:"timeout"`
+	Retries        int               `mapstructure:"retries"`
+	Job            string            `mapstructure:"job"`
+	Labels         map[string]string `mapstructure:"labels"`
+	Username       string            `mapstructure:"username"`
+	Password       string            `mapstructure:"password" secret:"true"`
+	BearerToken    string            `mapstructure:"bearer_token" secret:"true"`
+}
+
+// InfluxdbConfig writes disk samples and speedtest results as line protocol,
+// disabled while Url is empty. Url is the server for HTTP writes, using the
+// v1 /write API (Database, RetentionPolicy, Username, Password) or the v2
+// /api/v2/write API (Org, Bucket, Token), or udp://host:port for a UDP
+// listener. Points are sent every FlushInterval or once BatchSize are
+// waiting. Tags are added to every point, host defaulting to the hostname.
+type InfluxdbConfig struct {
+	Url                  string            `mapstructure:"url"`
+	Version              int               `mapstructure:"version"`
+	Database             string            `mapstructure:"database"`
+	RetentionPolicy      string            `mapstructure:"retention_policy"`
+	Username             string            `mapstructure:"username"`
+	Password             string            `mapstructure:"password" secret:"true"`
+	Org                  string            `mapstructure:"org"`
+	Bucket               string            `mapstructure:"bucket"`
+	Token                string            `mapstructure:"token" secret:"true"`
+	BatchSize            int               `mapstructure:"batch_size"`
+	FlushInterval        time.Duration     `mapstructure:"flush_interval"`
+	Timeout              time.Duration     `mapstructure:"timeout"`
+	Retries              int               `mapstructure:"retries"`
+	DiskMeasurement      string            `mapstructure:"disk_measurement"`
+	SpeedTestMeasurement string            `mapstructure:"speedtest_measurement"`
+	Tags                 map[string]string `mapstructure:"tags"`
+}
+
+// OtelConfig exports traces and metrics over OTLP, disabled while Endpoint
+// is empty. Endpoint is the collector's base URL, https meaning TLS, and
+// Protocol is http/protobuf or grpc. Traces cover job runs, df calls,
+// speedtest phases and Telegram sends; SampleRatio is the share of job runs
+// traced. Metrics are the Prometheus registry, exported every
+// MetricsInterval. Headers come from OTEL_EXPORTER_OTLP_HEADERS.
+type OtelConfig struct {
+	Endpoint        string        `mapstructure:"endpoint"`
+	Protocol        string        `mapstructure:"protocol"`
+	ServiceName     string        `mapstructure:"service_name"`
+	Traces          bool          `mapstructure:"traces"`
+	Metrics         bool          `mapstructure:"metrics"`
+	SampleRatio     float64       `mapstructure:"sample_ratio"`
+	MetricsInterval time.Duration `mapstructure:"metrics_interval"`
+}
+
+// ApiToken grants API access. Token holds the secret in plain text,
+// TokenSha256 its hex encoded SHA-256 digest instead. RateLimit is in
+// requests per minute, 0 means unlimited.
+type ApiToken struct {
+	Name        string   `mapstructure:"name"`
+	Token       string   `mapstructure:"token" secret:"true"`
+	TokenSha256 string   `mapstructure:"token_sha256"`
+	Scopes      []string `mapstructure:"scopes"`
+	RateLimit   float64  `mapstructure:"rate_limit"`
+}
+
+var (
+	defaults  = map[string]any{}
+	schedules = map[string]string{}
+	jobNames  = map[string]bool{}
+)
+
+// RegisterDefault sets the default for a config key owned by another
+// package, e.g. the settings each job declares in its registry entry.
+func RegisterDefault(key string, value any) {
+	defaults[key] = value
+}
+
+// RegisterSchedule marks key as a cron expression validated on Load.
+// enabledKey, if set, names the flag that makes the schedule mandatory.
+func RegisterSchedule(key, enabledKey string) {
+	schedules[key] = enabledKey
+}
+
+// RegisterJob makes name a valid key under jobs.
+func RegisterJob(name string) {
+	jobNames[name] = true
 }
 
 func Load(path string) (*Config, error) {
+	return load(path, nil)
+}
+
+// LoadKeys loads the config like Load, but only fails on problems with the
+// given keys or the ones below them, for commands that use a small part of
+// it. Problems not tied to a key still count.
+func LoadKeys(path string, keys ...string) (*Config, error) {
+	return load(path, keys)
+}
+
+func load(path string, keys []string) (*Config, error) {
 	v := viper.New()
 	v.SetConfigType("yaml")
 
@@ -59,17 +247,73 @@ func Load(path string) (*Config, error) {
 	}
 
 	// Set defaults
-	v.SetDefault("cron_run_motioneye_disk_usage_job", false)
-	v.SetDefault("cron_run_plex_disk_usage_job", false)
-	v.SetDefault("cron_run_server_disk_usage_job", false)
-	v.SetDefault("cron_run_speed_test_job", false)
-	v.SetDefault("cron_run_motioneye_metrics_job", false)
-	v.SetDefault("cron_run_server_metrics_job", false)
-	v.SetDefault("cron_run_plex_metrics_job", false)
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetDefault("data_dir", "./data")
+	v.SetDefault("disk_warn_percent", common.DefaultDiskWarnPercent)
+	v.SetDefault("disk_crit_percent", common.DefaultDiskCritPercent)
+	v.SetDefault("shutdown_timeout", "30s")
+	v.SetDefault("catch_up_window", "0s")
+	v.SetDefault("catch_up_jitter", "0s")
+	v.SetDefault("http.listen", ":1324")
+	v.SetDefault("http.tls_cert_file", "")
+	v.SetDefault("http.tls_key_file", "")
+	v.SetDefault("http.tls_client_ca_file", "")
+	v.SetDefault("http.read_timeout", "15s")
+	v.SetDefault("http.write_timeout", "90s")
+	v.SetDefault("http.idle_timeout", "120s")
+	v.SetDefault("http.metrics_listen", "")
+	v.SetDefault("mqtt.broker", "")
+	v.SetDefault("mqtt.client_id", "")
+	v.SetDefault("mqtt.username", "")
+	v.SetDefault("mqtt.password", "")
+	v.SetDefault("mqtt.topic_prefix", "servers-stats")
+	v.SetDefault("mqtt.discovery_prefix", "homeassistant")
+	v.SetDefault("mqtt.node_id", "")
+	v.SetDefault("mqtt.qos", 0)
+	v.SetDefault("mqtt.retain", true)
+	v.SetDefault("metrics_push.pushgateway_url", "")
+	v.SetDefault("metrics_push.remote_write_url", "")
+	v.SetDefault("metrics_push.interval", "60s")
+	v.SetDefault("metrics_push.timeout", "10s")
+	v.SetDefault("metrics_push.retries", 3)
+	v.SetDefault("metrics_push.job", "servers-stats")
+	v.SetDefault("metrics_push.username", "")
+	v.SetDefault("metrics_push.password", "")
+	v.SetDefault("metrics_push.bearer_token", "")
+	v.SetDefault("influxdb.url", "")
+	v.SetDefault("influxdb.version", 2)
+	v.SetDefault("influxdb.database", "")
+	v.SetDefault("influxdb.retention_policy", "")
+	v.SetDefault("influxdb.username", "")
+	v.SetDefault("influxdb.password", "")
+	v.SetDefault("influxdb.org", "")
+	v.SetDefault("influxdb.bucket", "")
+	v.SetDefault("influxdb.token", "")
+	v.SetDefault("influxdb.batch_size", 100)
+	v.SetDefault("influxdb.flush_interval", "10s")
+	v.SetDefault("influxdb.timeout", "10s")
+	v.SetDefault("influxdb.retries", 3)
+	v.SetDefault("influxdb.disk_measurement", "disk_usage")
+	v.SetDefault("influxdb.speedtest_measurement", "speedtest")
+	v.SetDefault("otel.endpoint", "")
+	v.SetDefault("otel.protocol", "http/protobuf")
+	v.SetDefault("otel.service_name", "servers-stats")
+	v.SetDefault("otel.traces", true)
+	v.SetDefault("otel.metrics", true)
+	v.SetDefault("otel.sample_ratio", 1)
+	v.SetDefault("otel.metrics_interval", "60s")
 
 	// Bind environment variables for sensitive data (optional override)
-	v.BindEnv("tgbot_api_key", "TGBOT_API_KEY")
-	v.BindEnv("tgbot_chat_id", "TGBOT_CHAT_ID")
+	bindings := map[string][]string{
+		"tgbot_api_key":      {"TGBOT_API_KEY"},
+		"tgbot_api_key_file": {"TGBOT_API_KEY_FILE", "SERVERS_STATS_TGBOT_API_KEY_FILE"},
+		"tgbot_chat_id":      {"TGBOT_CHAT_ID"},
+	}
+	for key, names := range bindings {
+		v.BindEnv(append([]string{key}, names...)...)
+	}
 
 	// Try to read config file, but don't fail if it doesn't exist
 	// when using environment variables
@@ -81,40 +325,30 @@ func Load(path string) (*Config, error) {
 		// Config file not found, continue with env vars and defaults
 	}
 
+	var errs problems
+	layers := loadLayers(v, v.ConfigFileUsed(), &errs)
+	interpolate(v, &errs)
+	warnings, secretFiles := resolveSecretFiles(v, &errs)
+
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
-	}
-
-	if strings.TrimSpace(cfg.CronMotioneyeDiskUsageJobPath) == "" {
-		cfg.CronRunMotioneyeDiskUsageJob = false
-	}
-
-	if strings.TrimSpace(cfg.CronPlexDiskUsageJobPath) == "" {
-		cfg.CronRunPlexDiskUsageJob = false
+		// mapstructure decodes what it can and reports every field it
+		// couldn't, so keep going and report those alongside the rest.
+		errs.addError(err)
 	}
+	cfg.file = v.ConfigFileUsed()
+	cfg.files = layers.files
+	cfg.sources = sources(&cfg, layers.origins, bindings, secretFiles)
 
-	if strings.TrimSpace(cfg.CronServerDiskUsageJobPath) == "" {
-		cfg.CronRunServerDiskUsageJob = false
+	cfg.warnings = append(warnings, disableJobsWithoutPath(&cfg)...)
+	errs.unknownKeys(v)
+	validate(v, &cfg, &errs)
+	if keys != nil {
+		errs.keep(keys)
 	}
 
-	// Validate required fields
-	required := map[string]string{
-		"app_env":       cfg.Environment,
-		"log_level":     cfg.LogLevel,
-		"tgbot_api_key": cfg.TgBotApiKey,
-		"tgbot_chat_id": cfg.TgBotChatId,
+	if err := errs.err(); err != nil {
+		return nil, err
 	}
-	for k, v := range required {
-		if strings.TrimSpace(v) == "" {
-			return nil, fmt.Errorf("required config %s is empty (set via config file or environment variable)", k)
-		}
-	}
-
-	// Validate API key format (basic check)
-	if !strings.Contains(cfg.TgBotApiKey, ":") {
-		return nil, fmt.Errorf("invalid telegram bot API key format")
-	}
-
 	return &cfg, nil
 }
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SourceDefault    = "default"
+	SourceFile       = "file"
+	SourceEnv        = "env"
+	SourceSecretFile = "secret_file"
+	SourceFlag       = "flag"
+	SourceProfile    = "profile"
+)
+
+// Setting is one effective config value. Origin names the environment
+// variable, file or flag the value came from, where there is one.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// ValueString formats the value for text output, lists and maps as JSON.
+func (s Setting) ValueString() string {
+	switch reflect.ValueOf(s.Value).Kind() {
+	case reflect.Slice, reflect.Map:
+		b, _ := json.Marshal(s.Value)
+		return string(b)
+	}
+	return fmt.Sprint(s.Value)
+}
+
+type origin struct {
+	source, name string
+}
+
+// OverrideLogLevel applies the --log-level flag, recording it as the source.
+func (c *Config) OverrideLogLevel(level string) {
+	c.LogLevel = level
+	if c.sources == nil {
+		c.sources = map[string]origin{}
+	}
+	c.sources["log_level"] = origin{SourceFlag, "--log-level"}
+}
+
+// Settings lists every effective value with its source, secrets redacted,
+// sorted by key.
+func (c *Config) Settings() []Setting {
+	var out []Setting
+	flatten(reflect.ValueOf(c.Redacted()).Elem(), "", func(key string, value any) {
+		o, ok := c.sources[key]
+		if !ok {
+			o = origin{source: SourceDefault}
+		}
+		out = append(out, Setting{Key: key, Value: value, Source: o.source, Origin: o.name})
+	})
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// sources works out where viper took each value of c from, checking in the
+// order viper does: the prefixed variable, then explicit bindings, then the
+// config layers. secretFiles maps keys to the _file path they were read from.
+func sources(c *Config, layers map[string]origin, bindings map[string][]string, secretFiles map[string]string) map[string]origin {
+	replacer := strings.NewReplacer(".", "_")
+	out := map[string]origin{}
+
+	flatten(reflect.ValueOf(c).Elem(), "", func(key string, _ any) {
+		if path, ok := secretFiles[key]; ok {
+			out[key] = origin{SourceSecretFile, path}
+			return
+		}
+
+		names := append([]string{"SERVERS_STATS_" + strings.ToUpper(replacer.Replace(key))}, bindings[key]...)
+		for _, name := range names {
+			if os.Getenv(name) != "" {
+				out[key] = origin{SourceEnv, name}
+				return
+			}
+		}
+
+		if o, ok := layers[key]; ok {
+			out[key] = o
+			return
+		}
+		// Maps such as metrics_push.labels are recorded per entry
+		for _, k := range sortedKeys(layers) {
+			if strings.HasPrefix(k, key+".") {
+				out[key] = layers[k]
+				return
+			}
+		}
+	})
+	return out
+}
+
+// flatten calls fn with the dotted key and plain value of every leaf of v,
+// which must be a struct with mapstructure tags. Lists are leaves.
+func flatten(v reflect.Value, prefix string, fn func(key string, value any)) {
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
+		field := v.Field(i)
+		key := prefix + tag
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			flatten(field, key+".", fn)
+		case field.Kind() == reflect.Map && field.Type().Elem().Kind() == reflect.Struct:
+			names := make([]string, 0, field.Len())
+			for _, k := range field.MapKeys() {
+				names = append(names, k.String())
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				flatten(field.MapIndex(reflect.ValueOf(name)), key+"."+name+".", fn)
+			}
+		default:
+			fn(key, plain(field))
+		}
+	}
+}
+
+// plain converts v for printing: durations become strings and structs maps
+// keyed by their mapstructure tags.
+func plain(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := map[string]any{}
+		for i := 0; i < v.NumField(); i++ {
+			if tag := v.Type().Field(i).Tag.Get("mapstructure"); tag != "" {
+				out[tag] = plain(v.Field(i))
+			}
+		}
+		return out
+	case reflect.Slice:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = plain(v.Index(i))
+		}
+		return out
+	}
+	return v.Interface()
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"sync/atomic"
+
+	"github.com/koss-shtukert/servers-stats/common"
+)
+
+// Live holds the active configuration. Long-running components keep the
+// *Live and call Get once per unit of work (a job run, a request, an
+// update), so a reload applies between those rather than halfway through.
+type Live struct {
+	current atomic.Pointer[Config]
+}
+
+func NewLive(c *Config) *Live {
+	l := &Live{}
+	l.Set(c)
+	return l
+}
+
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// Set activates c and returns the configuration it replaced. It also applies
+// the disk thresholds, which common reads without a *Live.
+func (l *Live) Set(c *Config) *Config {
+	if c.DiskWarnPercent > 0 && c.DiskCritPercent > 0 {
+		common.SetDiskThresholds(c.DiskWarnPercent, c.DiskCritPercent)
+	}
+	return l.current.Swap(c)
+}
+
+// RestartRequired lists the changed keys that only take effect on restart.
+func RestartRequired(prev, next *Config) []string {
+	var keys []string
+	if prev.TgBotApiKey != next.TgBotApiKey {
+		keys = append(keys, "tgbot_api_key")
+	}
+	if prev.DataDir != next.DataDir {
+		keys = append(keys, "data_dir")
+	}
+	if prev.Http != next.Http {
+		keys = append(keys, "http")
+	}
+	if prev.Mqtt != next.Mqtt {
+		keys = append(keys, "mqtt")
+	}
+	if prev.Otel != next.Otel {
+		keys = append(keys, "otel")
+	}
+	return keys
+}
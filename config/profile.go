@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	includeKey      = "include"
+	maxIncludeDepth = 8
+)
+
+// profileDefaults replace the built-in defaults for an app_env, so e.g. a
+// dev instance doesn't run speedtests against the shared uplink unless its
+// config says so. The config files override them.
+var profileDefaults = map[string]map[string]any{
+	"dev": {
+		"log_level":                  "debug",
+		"cron_run_speed_test_job":    false,
+		"cron_run_daily_digest_job":  false,
+		"cron_run_weekly_digest_job": false,
+	},
+	"stage": {
+		"cron_run_speed_test_job": false,
+	},
+}
+
+// testChatProfiles send every message to tgbot_test_chat_id when it is set.
+var testChatProfiles = map[string]bool{"dev": true}
+
+// layers merges the config files into v, later layers winning:
+//
+//	the built-in defaults of the app_env profile
+//	base file, after the files it includes
+//	config.<env>.yaml next to the base file, after the files it includes
+//
+// It keeps track of the files read and which layer each key came from.
+type layers struct {
+	v       *viper.Viper
+	p       *problems
+	files   []string
+	origins map[string]origin
+	reading map[string]bool
+}
+
+func loadLayers(v *viper.Viper, base string, p *problems) *layers {
+	l := &layers{v: v, p: p, origins: map[string]origin{}, reading: map[string]bool{}}
+
+	if base != "" {
+		// Start over from an empty config, ReadInConfig only located base
+		v.ReadConfig(strings.NewReader(""))
+		l.mergeFile(base, 0)
+	}
+
+	// app_env comes from the base file, so the profile is applied as
+	// defaults, beneath it
+	env := v.GetString("app_env")
+	for key, value := range profileDefaults[env] {
+		v.SetDefault(key, value)
+		if _, ok := l.origins[key]; !ok {
+			l.origins[key] = origin{SourceProfile, env}
+		}
+	}
+
+	if base != "" && env != "" {
+		overlay := overlayPath(base, env)
+		if _, err := os.Stat(overlay); err == nil {
+			l.mergeFile(overlay, 0)
+			if got := v.GetString("app_env"); got != env {
+				p.add("app_env", "%s changes app_env to %q, it can only be set in the base config or environment", overlay, got)
+			}
+		}
+	}
+
+	return l
+}
+
+// UsesTestChat reports whether the app_env profile redirects messages to
+// tgbot_test_chat_id.
+func (c *Config) UsesTestChat() bool {
+	return testChatProfiles[c.Environment] && strings.TrimSpace(c.TgBotTestChatId) != ""
+}
+
+// NotifyChatId returns the chat the bot writes to.
+func (c *Config) NotifyChatId() string {
+	if c.UsesTestChat() {
+		return c.TgBotTestChatId
+	}
+	return c.TgBotChatId
+}
+
+// overlayPath returns config.<env>.yaml for config.yaml, keeping the
+// directory and extension of base.
+func overlayPath(base, env string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+func (l *layers) mergeFile(path string, depth int) {
+	if l.reading[path] {
+		l.p.add(includeKey, "%s includes itself", path)
+		return
+	}
+	if depth > maxIncludeDepth {
+		l.p.add(includeKey, "%s: includes nested deeper than %d levels", path, maxIncludeDepth)
+		return
+	}
+	l.reading[path] = true
+	defer delete(l.reading, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.p.add(includeKey, "%s", err)
+		return
+	}
+
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		l.p.add(includeKey, "%s: %s", path, err)
+		return
+	}
+
+	includes, err := includesOf(m[includeKey])
+	if err != nil {
+		l.p.add(includeKey, "%s: %s", path, err)
+	}
+	delete(m, includeKey)
+
+	// Included files first, so the including file has the last word
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			l.p.add(includeKey, "%s: %s", path, err)
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			l.p.add(includeKey, "%s: %s does not exist", path, pattern)
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			l.mergeFile(match, depth+1)
+		}
+	}
+
+	if err := l.v.MergeConfigMap(m); err != nil {
+		l.p.add(includeKey, "%s: %s", path, err)
+		return
+	}
+	flattenMap(m, "", func(key string) {
+		l.origins[key] = origin{SourceFile, path}
+	})
+	l.files = append(l.files, path)
+}
+
+// includesOf accepts a single path or a list of paths, globs allowed.
+func includesOf(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []any:
+		out := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("include entries must be paths, got %v", item)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("include must be a path or a list of paths")
+}
+
+func flattenMap(m map[string]any, prefix string, fn func(key string)) {
+	for k, value := range m {
+		key := prefix + strings.ToLower(k)
+		if nested, ok := value.(map[string]any); ok {
+			flattenMap(nested, key+".", fn)
+			continue
+		}
+		fn(key)
+	}
+}
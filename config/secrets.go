@@ -0,0 +1,296 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SecretProvider resolves the reference of a ${name:ref} placeholder, e.g.
+// the path in ${file:/run/secrets/tgbot_api_key}.
+type SecretProvider func(ref string) (string, error)
+
+var (
+	secretProviders = map[string]SecretProvider{
+		"file": fileSecret,
+		"exec": execSecret,
+	}
+
+	placeholderPattern = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	envNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+const (
+	secretFileSuffix = "_file"
+	execTimeout      = 10 * time.Second
+	redacted         = "[REDACTED]"
+)
+
+// RegisterSecretProvider makes ${name:ref} placeholders resolve through p.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	secretProviders[name] = p
+}
+
+func fileSecret(ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// execSecret runs ref, split on whitespace without a shell, and returns its
+// output, e.g. ${exec:pass show servers-stats/tgbot}.
+func execSecret(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &out
+	// stderr is dropped, it may well echo the secret
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
+
+// interpolate expands the placeholders in every string value: ${NAME} and
+// ${NAME:-default} from the environment, ${provider:ref} through a secret
+// provider. $${ is a literal ${.
+func interpolate(v *viper.Viper, p *problems) {
+	for _, key := range v.AllKeys() {
+		value, changed := expandValue(key, v.Get(key), p)
+		if changed {
+			v.Set(key, value)
+		}
+	}
+}
+
+func expandValue(key string, value any, p *problems) (any, bool) {
+	switch value := value.(type) {
+	case string:
+		if !strings.Contains(value, "${") {
+			return value, false
+		}
+		return expand(key, value, p), true
+	case []any:
+		out := make([]any, len(value))
+		changed := false
+		for i, item := range value {
+			var c bool
+			out[i], c = expandValue(fmt.Sprintf("%s[%d]", key, i), item, p)
+			changed = changed || c
+		}
+		return out, changed
+	case map[string]any:
+		out := make(map[string]any, len(value))
+		changed := false
+		for k, item := range value {
+			var c bool
+			out[k], c = expandValue(key+"."+k, item, p)
+			changed = changed || c
+		}
+		return out, changed
+	}
+	return value, false
+}
+
+func expand(key, s string, p *problems) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		inner := m[2 : len(m)-1]
+
+		if name, def, ok := strings.Cut(inner, ":-"); ok && envNamePattern.MatchString(name) {
+			if value, ok := os.LookupEnv(name); ok && value != "" {
+				return value
+			}
+			return def
+		}
+
+		if name, ref, ok := strings.Cut(inner, ":"); ok {
+			provider, known := secretProviders[name]
+			if !known {
+				p.fail(key, "unknown secret provider %q in %s", name, m)
+				return ""
+			}
+			value, err := provider(ref)
+			if err != nil {
+				p.fail(key, "%s secret provider failed: %s", name, err)
+				return ""
+			}
+			return value
+		}
+
+		if !envNamePattern.MatchString(inner) {
+			p.fail(key, "invalid placeholder %s", m)
+			return ""
+		}
+		value, ok := os.LookupEnv(inner)
+		if !ok {
+			p.fail(key, "environment variable %s is not set", inner)
+		}
+		return value
+	})
+}
+
+// resolveSecretFiles reads <key>_file settings, the Docker secrets
+// convention, into the secret they name. The file wins over a value set
+// directly, which only earns a warning. It returns the warnings and the file
+// each top-level secret was read from.
+func resolveSecretFiles(v *viper.Viper, p *problems) ([]string, map[string]string) {
+	var warnings []string
+	files := map[string]string{}
+	for _, key := range secretKeys(reflect.TypeOf(Config{}), "") {
+		fileKey := key + secretFileSuffix
+		path := v.GetString(fileKey)
+		if path == "" {
+			continue
+		}
+
+		value, err := fileSecret(path)
+		if err != nil {
+			p.fail(key, "%s: %s", fileKey, err)
+			continue
+		}
+		if v.GetString(key) != "" {
+			warnings = append(warnings, fmt.Sprintf("both %s and %s are set, using %s", key, fileKey, fileKey))
+		}
+		v.Set(key, value)
+		files[key] = path
+	}
+
+	// Entries of lists such as api_tokens take <key>_file too
+	for _, key := range v.AllKeys() {
+		items, ok := v.Get(key).([]any)
+		field, found := fieldByTag(reflect.TypeOf(Config{}), key)
+		if !ok || !found || field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		changed := false
+		for i, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, secret := range secretKeys(field.Type.Elem(), "") {
+				path, ok := m[secret+secretFileSuffix].(string)
+				if !ok {
+					continue
+				}
+				itemKey := fmt.Sprintf("%s[%d].%s", key, i, secret+secretFileSuffix)
+				delete(m, secret+secretFileSuffix)
+				changed = true
+
+				value, err := fileSecret(path)
+				if err != nil {
+					p.fail(itemKey, "%s", err)
+					continue
+				}
+				if m[secret] != nil && m[secret] != "" {
+					warnings = append(warnings, fmt.Sprintf("both %s and %s are set, using %s", strings.TrimSuffix(itemKey, secretFileSuffix), itemKey, itemKey))
+				}
+				m[secret] = value
+			}
+		}
+		if changed {
+			v.Set(key, items)
+		}
+	}
+	return warnings, files
+}
+
+// secretKeys lists the keys of t's fields tagged secret:"true", descending
+// into nested structs but not into lists.
+func secretKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("mapstructure")
+		if tag == "" {
+			continue
+		}
+		if f.Tag.Get("secret") == "true" {
+			keys = append(keys, prefix+tag)
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Duration(0)) {
+			keys = append(keys, secretKeys(f.Type, prefix+tag+".")...)
+		}
+	}
+	return keys
+}
+
+func isSecretFileKey(t reflect.Type, key string) bool {
+	base, ok := strings.CutSuffix(key, secretFileSuffix)
+	if !ok {
+		return false
+	}
+	for _, k := range secretKeys(t, "") {
+		if k == base {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets returns every non-empty secret value in c, for log redaction.
+func (c *Config) Secrets() []string {
+	var out []string
+	walkSecrets(reflect.ValueOf(c).Elem(), func(v reflect.Value) {
+		if s := v.String(); s != "" {
+			out = append(out, s)
+		}
+	})
+	return out
+}
+
+// Redacted returns a copy of c with every secret replaced, safe to print.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.ApiTokens = append([]ApiToken(nil), c.ApiTokens...)
+	walkSecrets(reflect.ValueOf(&out).Elem(), func(v reflect.Value) {
+		if v.String() != "" {
+			v.SetString(redacted)
+		}
+	})
+	return &out
+}
+
+// walkSecrets calls fn with every string field tagged secret:"true" in v.
+// Slices are walked in place, callers wanting a copy must copy them first.
+func walkSecrets(v reflect.Value, fn func(reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if f.Tag.Get("secret") == "true" && f.Type.Kind() == reflect.String {
+				fn(v.Field(i))
+				continue
+			}
+			walkSecrets(v.Field(i), fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), fn)
+		}
+	}
+}
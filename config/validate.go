@@ -0,0 +1,787 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+var (
+	botTokenPattern = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]+$`)
+	nodeIdPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	labelPattern    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Problem is a single invalid setting. Key is empty for the rare problem
+// that can't be tied to one.
+type Problem struct {
+	Key     string
+	Message string
+}
+
+// ValidationError lists every problem Load found, so a config can be fixed
+// in one go rather than one error per restart.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("1 config problem:")
+	} else {
+		fmt.Fprintf(&b, "%d config problems:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		if p.Key == "" {
+			fmt.Fprintf(&b, "\n  - %s", p.Message)
+		} else {
+			fmt.Fprintf(&b, "\n  - %s: %s", p.Key, p.Message)
+		}
+	}
+	return b.String()
+}
+
+var decodeErrorPattern = regexp.MustCompile(`^error decoding '([^']+)': (.*)$`)
+
+// problems collects Problems. Keys that failed to resolve or decode are
+// skipped by later checks, their zero value would only repeat the error.
+type problems struct {
+	list   []Problem
+	failed map[string]bool
+}
+
+func (p *problems) add(key, format string, args ...any) {
+	if p.failed[key] {
+		return
+	}
+	p.list = append(p.list, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// fail adds a problem and silences later ones for key.
+func (p *problems) fail(key, format string, args ...any) {
+	p.add(key, format, args...)
+	if p.failed == nil {
+		p.failed = map[string]bool{}
+	}
+	p.failed[key] = true
+}
+
+func (p *problems) addError(err error) {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			p.addError(inner)
+		}
+		return
+	case interface{ Unwrap() error }:
+		if !decodeErrorPattern.MatchString(err.Error()) {
+			p.addError(e.Unwrap())
+			return
+		}
+	}
+
+	if m := decodeErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		p.fail(m[1], "%s", m[2])
+		return
+	}
+	p.list = append(p.list, Problem{Message: err.Error()})
+}
+
+// keep drops the problems with keys other than keys and those below them.
+func (p *problems) keep(keys []string) {
+	list := p.list[:0]
+	for _, pr := range p.list {
+		if pr.Key == "" || slices.ContainsFunc(keys, func(k string) bool {
+			return pr.Key == k || strings.HasPrefix(pr.Key, k+".") || strings.HasPrefix(pr.Key, k+"[")
+		}) {
+			list = append(list, pr)
+		}
+	}
+	p.list = list
+}
+
+func (p *problems) err() error {
+	if len(p.list) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p.list}
+}
+
+// pathJob is a job reading the disk at a configured path. fallback, if set,
+// is used when the path is empty.
+type pathJob struct {
+	enabledKey, pathKey string
+	enabled             *bool
+	path, fallback      string
+}
+
+func pathJobs(c *Config) []pathJob {
+	return []pathJob{
+		{"cron_run_motioneye_disk_usage_job", "cron_motioneye_disk_usage_job_path", &c.CronRunMotioneyeDiskUsageJob, c.CronMotioneyeDiskUsageJobPath, ""},
+		{"cron_run_motioneye_metrics_job", "cron_motioneye_disk_usage_job_path", &c.CronRunMotioneyeMetricsJob, c.CronMotioneyeDiskUsageJobPath, ""},
+		{"cron_run_plex_disk_usage_job", "cron_plex_disk_usage_job_path", &c.CronRunPlexDiskUsageJob, c.CronPlexDiskUsageJobPath, ""},
+		{"cron_run_plex_metrics_job", "cron_plex_disk_usage_job_path", &c.CronRunPlexMetricsJob, c.CronPlexDiskUsageJobPath, ""},
+		{"cron_run_server_disk_usage_job", "cron_server_disk_usage_job_path", &c.CronRunServerDiskUsageJob, c.CronServerDiskUsageJobPath, ""},
+		{"cron_run_server_metrics_job", "cron_server_disk_usage_job_path", &c.CronRunServerMetricsJob, c.CronServerDiskUsageJobPath, "/"},
+	}
+}
+
+// disableJobsWithoutPath turns off disk and metrics jobs that are enabled
+// without a path and returns a warning for each, or for the path used
+// instead when the job has a fallback.
+func disableJobsWithoutPath(c *Config) []string {
+	var warnings []string
+	for _, j := range pathJobs(c) {
+		if !*j.enabled || strings.TrimSpace(j.path) != "" {
+			continue
+		}
+		if j.fallback != "" {
+			warnings = append(warnings, fmt.Sprintf("%s is empty, %s measures %s", j.pathKey, j.enabledKey, j.fallback))
+			continue
+		}
+		*j.enabled = false
+		warnings = append(warnings, fmt.Sprintf("%s is true but %s is empty, job disabled", j.enabledKey, j.pathKey))
+	}
+	return warnings
+}
+
+// unknownKeys reports every key that doesn't map to a Config field, with the
+// closest known key as a suggestion.
+func (p *problems) unknownKeys(v *viper.Viper) {
+	for _, key := range v.AllKeys() {
+		if isSecretFileKey(reflect.TypeOf(Config{}), key) {
+			continue
+		}
+
+		ok, prefix, candidates := lookupKey(reflect.TypeOf(Config{}), strings.Split(key, "."))
+		if !ok {
+			p.add(key, "unknown setting%s", suggest(key, prefix, candidates))
+			continue
+		}
+
+		if items, isList := v.Get(key).([]any); isList {
+			p.unknownItemKeys(key, items)
+		}
+	}
+
+	for name := range v.GetStringMap("jobs") {
+		if !jobNames[name] {
+			p.add("jobs."+name, "unknown job%s", suggest(name, "", sortedKeys(jobNames)))
+		}
+	}
+}
+
+// unknownItemKeys checks the keys of list entries such as api_tokens, which
+// viper doesn't flatten into AllKeys.
+func (p *problems) unknownItemKeys(key string, items []any) {
+	field, ok := fieldByTag(reflect.TypeOf(Config{}), key)
+	if !ok || field.Type.Kind() != reflect.Slice || field.Type.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	known := tags(field.Type.Elem())
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for k := range m {
+			if !slices.Contains(known, strings.ToLower(k)) {
+				p.add(fmt.Sprintf("%s[%d].%s", key, i, k), "unknown setting%s", suggest(k, "", known))
+			}
+		}
+	}
+}
+
+// lookupKey walks t along parts. When a part doesn't match, it returns the
+// path walked so far and the names that would have been valid there.
+func lookupKey(t reflect.Type, parts []string) (bool, string, []string) {
+	var walked []string
+	for _, part := range parts {
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByTag(t, part)
+			if !ok {
+				return false, keyPrefix(walked), tags(t)
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return false, keyPrefix(walked), nil
+		}
+		walked = append(walked, part)
+	}
+	return true, "", nil
+}
+
+func keyPrefix(parts []string) string {
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ".") + "."
+}
+
+func fieldByTag(t reflect.Type, tag string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("mapstructure") == tag {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func tags(t reflect.Type) []string {
+	var out []string
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// suggest returns a "did you mean" hint for the candidate closest to key, if
+// any is close enough to be a likely typo.
+func suggest(key, prefix string, candidates []string) string {
+	last := key[strings.LastIndex(key, ".")+1:]
+
+	best, bestDist := "", 4
+	for _, c := range candidates {
+		if d := distance(last, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s%s?", prefix, best)
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func validate(v *viper.Viper, c *Config, p *problems) {
+	required := map[string]string{
+		"app_env":       c.Environment,
+		"log_level":     c.LogLevel,
+		"tgbot_api_key": c.TgBotApiKey,
+		"tgbot_chat_id": c.TgBotChatId,
+	}
+	for _, k := range sortedKeys(required) {
+		if strings.TrimSpace(required[k]) == "" {
+			p.add(k, "required (set via config file or environment variable)")
+		}
+	}
+
+	switch c.Environment {
+	case "", "dev", "stage", "prod":
+	default:
+		p.add("app_env", "invalid value %q (expected dev, stage or prod)", c.Environment)
+	}
+
+	if c.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+			p.add("log_level", "invalid level %q (expected panic, fatal, error, warn, info, debug or trace)", c.LogLevel)
+		}
+	}
+
+	if c.TgBotApiKey != "" && !botTokenPattern.MatchString(c.TgBotApiKey) {
+		p.add("tgbot_api_key", "invalid format (expected <bot id>:<secret> as issued by @BotFather)")
+	}
+	validateChatId(p, "tgbot_chat_id", c.TgBotChatId)
+	validateChatId(p, "tgbot_test_chat_id", c.TgBotTestChatId)
+	validateChatId(p, "digest_tgbot_chat_id", c.DigestTgBotChatId)
+	for i, id := range c.TgBotAdminUserIds {
+		if id <= 0 {
+			p.add(fmt.Sprintf("tgbot_admin_user_ids[%d]", i), "invalid user id %d (expected a positive number)", id)
+		}
+	}
+
+	validateSchedules(v, p)
+	validatePaths(c, p)
+	validateDiskThresholds(c, p)
+	validateSpeedTest(c, p)
+
+	if c.ShutdownTimeout <= 0 {
+		p.add("shutdown_timeout", "must be positive, got %s", c.ShutdownTimeout)
+	}
+	if c.CatchUpWindow < 0 {
+		p.add("catch_up_window", "must not be negative, got %s", c.CatchUpWindow)
+	}
+	if c.CatchUpJitter < 0 {
+		p.add("catch_up_jitter", "must not be negative, got %s", c.CatchUpJitter)
+	}
+
+	for _, name := range sortedKeys(c.Jobs) {
+		opts := c.Jobs[name]
+		switch opts.Overlap {
+		case "", "skip", "queue":
+		default:
+			p.add("jobs."+name+".overlap", "invalid value %q (expected skip or queue)", opts.Overlap)
+		}
+		if opts.Timeout < 0 {
+			p.add("jobs."+name+".timeout", "must not be negative, got %s", opts.Timeout)
+		}
+	}
+
+	switch c.DigestNotifier {
+	case "telegram", "log":
+	default:
+		p.add("digest_notifier", "invalid value %q (expected telegram or log)", c.DigestNotifier)
+	}
+	for i, section := range c.DigestSections {
+		switch strings.ToLower(strings.TrimSpace(section)) {
+		case "disk", "speedtest", "alerts", "failures":
+		default:
+			p.add(fmt.Sprintf("digest_sections[%d]", i), "invalid section %q (expected disk, speedtest, alerts or failures)", section)
+		}
+	}
+
+	validateHttp(c.Http, p)
+	validateMqtt(c.Mqtt, p)
+	validateMetricsPush(c.MetricsPush, p)
+	validateInfluxdb(c.Influxdb, p)
+	validateOtel(c.Otel, p)
+	validateApiTokens(c.ApiTokens, p)
+}
+
+func validateChatId(p *problems, key, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		p.add(key, "invalid chat id %q (expected a number)", value)
+	}
+}
+
+func validateSchedules(v *viper.Viper, p *problems) {
+	for _, key := range sortedKeys(schedules) {
+		spec := strings.TrimSpace(v.GetString(key))
+		enabledKey := schedules[key]
+
+		if spec == "" {
+			if enabledKey != "" && v.GetBool(enabledKey) {
+				p.add(key, "required when %s is true", enabledKey)
+			}
+			continue
+		}
+
+		if _, err := common.ParseSchedule(spec); err != nil {
+			p.add(key, "invalid schedule %q: %s", spec, err)
+		}
+	}
+}
+
+// validatePaths checks the paths of enabled disk and metrics jobs exist;
+// jobs without a path were already disabled by disableJobsWithoutPath.
+func validatePaths(c *Config, p *problems) {
+	checked := map[string]bool{}
+	for _, j := range pathJobs(c) {
+		path := j.path
+		if strings.TrimSpace(path) == "" {
+			path = j.fallback
+		}
+		if !*j.enabled || path == "" || checked[j.pathKey] {
+			continue
+		}
+		checked[j.pathKey] = true
+		if _, err := os.Stat(path); err != nil {
+			p.add(j.pathKey, "%s", statError(path, err))
+		}
+	}
+
+	if info, err := os.Stat(c.DataDir); err == nil && !info.IsDir() {
+		p.add("data_dir", "%q is not a directory", c.DataDir)
+	}
+}
+
+func statError(path string, err error) string {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Sprintf("%q does not exist", path)
+	}
+	return err.Error()
+}
+
+// validateDiskThresholds checks the disk usage percentages, the warning
+// level sitting below the critical one.
+func validateDiskThresholds(c *Config, p *problems) {
+	pct := map[string]int{
+		"disk_warn_percent": c.DiskWarnPercent,
+		"disk_crit_percent": c.DiskCritPercent,
+	}
+	for _, key := range sortedKeys(pct) {
+		if value := pct[key]; value < 1 || value > 100 {
+			p.add(key, "must be between 1 and 100, got %d", value)
+		}
+	}
+	if c.DiskWarnPercent >= c.DiskCritPercent {
+		p.add("disk_warn_percent", "must be below disk_crit_percent (%d), got %d", c.DiskCritPercent, c.DiskWarnPercent)
+	}
+}
+
+// validateSpeedTest checks the speedtest thresholds. Percentages are
+// fractions of the expected speed, so the warning level sits above the
+// critical one; latencies are in ms, so the warning level sits below it.
+func validateSpeedTest(c *Config, p *problems) {
+	expected := map[string]float64{
+		"cron_speed_test_job_exp_down": c.CronSpeedTestJobExpDown,
+		"cron_speed_test_job_exp_up":   c.CronSpeedTestJobExpUp,
+	}
+	for _, key := range sortedKeys(expected) {
+		switch value := expected[key]; {
+		case value < 0:
+			p.add(key, "must not be negative, got %g", value)
+		case value == 0 && c.CronRunSpeedTestJob:
+			p.add(key, "required when cron_run_speed_test_job is true")
+		}
+	}
+
+	pct := map[string]float64{
+		"cron_speed_test_job_warn_pct": c.CronSpeedTestJobWarnPct,
+		"cron_speed_test_job_crit_pct": c.CronSpeedTestJobCritPct,
+	}
+	for _, key := range sortedKeys(pct) {
+		if value := pct[key]; value < 0 || value > 1 {
+			p.add(key, "must be between 0 and 1 (a fraction of the expected speed), got %g", value)
+		}
+	}
+	if c.CronSpeedTestJobCritPct > 0 && c.CronSpeedTestJobWarnPct <= c.CronSpeedTestJobCritPct {
+		p.add("cron_speed_test_job_warn_pct", "must be above cron_speed_test_job_crit_pct (%g), got %g", c.CronSpeedTestJobCritPct, c.CronSpeedTestJobWarnPct)
+	}
+
+	latency := map[string]float64{
+		"cron_speed_test_job_warn_lat": c.CronSpeedTestJobWarnLat,
+		"cron_speed_test_job_crit_lat": c.CronSpeedTestJobCritLat,
+	}
+	for _, key := range sortedKeys(latency) {
+		if value := latency[key]; value < 0 {
+			p.add(key, "must not be negative, got %g", value)
+		}
+	}
+	if c.CronSpeedTestJobWarnLat > 0 && c.CronSpeedTestJobCritLat > 0 && c.CronSpeedTestJobWarnLat >= c.CronSpeedTestJobCritLat {
+		p.add("cron_speed_test_job_warn_lat", "must be below cron_speed_test_job_crit_lat (%g), got %g", c.CronSpeedTestJobCritLat, c.CronSpeedTestJobWarnLat)
+	}
+}
+
+func validateApiTokens(tokens []ApiToken, p *problems) {
+	names := make(map[string]bool, len(tokens))
+	digests := make(map[string]string, len(tokens))
+	for i, t := range tokens {
+		key := fmt.Sprintf("api_tokens[%d]", i)
+		if strings.TrimSpace(t.Name) == "" {
+			p.add(key+".name", "required")
+		} else if names[t.Name] {
+			p.add(key+".name", "%q is used twice", t.Name)
+		}
+		names[t.Name] = true
+
+		switch {
+		case t.Token == "" && t.TokenSha256 == "":
+			p.add(key, "needs token or token_sha256")
+		case t.Token != "" && t.TokenSha256 != "":
+			p.add(key, "sets both token and token_sha256")
+		case t.TokenSha256 != "":
+			if raw, err := hex.DecodeString(t.TokenSha256); err != nil || len(raw) != sha256.Size {
+				p.add(key+".token_sha256", "must be 64 hex characters")
+			}
+		}
+
+		digest := strings.ToLower(t.TokenSha256)
+		if t.Token != "" {
+			sum := sha256.Sum256([]byte(t.Token))
+			digest = hex.EncodeToString(sum[:])
+		}
+		if other, ok := digests[digest]; ok && digest != "" {
+			p.add(key, "shares its secret with %s", other)
+		}
+		digests[digest] = key
+
+		if len(t.Scopes) == 0 {
+			p.add(key+".scopes", "at least one scope is required")
+		}
+		for _, scope := range t.Scopes {
+			switch scope {
+			case "read", "trigger", "admin":
+			default:
+				p.add(key+".scopes", "invalid scope %q (expected read, trigger or admin)", scope)
+			}
+		}
+
+		if t.RateLimit < 0 {
+			p.add(key+".rate_limit", "must not be negative, got %g", t.RateLimit)
+		}
+	}
+}
+
+func validateHttp(h HttpConfig, p *problems) {
+	if strings.TrimSpace(h.Listen) == "" {
+		p.add("http.listen", "required")
+	} else if err := validateListen(h.Listen); err != nil {
+		p.add("http.listen", "%s", err)
+	}
+	if h.MetricsListen != "" {
+		if err := validateListen(h.MetricsListen); err != nil {
+			p.add("http.metrics_listen", "%s", err)
+		} else if h.MetricsListen == h.Listen {
+			p.add("http.metrics_listen", "must differ from http.listen")
+		}
+	}
+
+	if (h.TlsCertFile == "") != (h.TlsKeyFile == "") {
+		p.add("http.tls_cert_file", "http.tls_cert_file and http.tls_key_file must be set together")
+	}
+	if h.TlsClientCaFile != "" && h.TlsCertFile == "" {
+		p.add("http.tls_client_ca_file", "requires http.tls_cert_file and http.tls_key_file")
+	}
+	files := map[string]string{
+		"http.tls_cert_file":      h.TlsCertFile,
+		"http.tls_key_file":       h.TlsKeyFile,
+		"http.tls_client_ca_file": h.TlsClientCaFile,
+	}
+	for _, key := range sortedKeys(files) {
+		if files[key] == "" {
+			continue
+		}
+		if _, err := os.Stat(files[key]); err != nil {
+			p.add(key, "%s", statError(files[key], err))
+		}
+	}
+
+	timeouts := map[string]time.Duration{
+		"http.read_timeout":  h.ReadTimeout,
+		"http.write_timeout": h.WriteTimeout,
+		"http.idle_timeout":  h.IdleTimeout,
+	}
+	for _, key := range sortedKeys(timeouts) {
+		if d := timeouts[key]; d < 0 {
+			p.add(key, "must not be negative, got %s", d)
+		}
+	}
+}
+
+func validateMqtt(m MqttConfig, p *problems) {
+	if m.Broker == "" {
+		return
+	}
+
+	u, err := url.Parse(m.Broker)
+	switch {
+	case err != nil:
+		p.add("mqtt.broker", "%s", err)
+	case u.Host == "":
+		p.add("mqtt.broker", "invalid broker %q (expected e.g. tcp://host:1883)", m.Broker)
+	default:
+		switch u.Scheme {
+		case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		default:
+			p.add("mqtt.broker", "unsupported scheme %q (expected tcp, ssl, ws or wss)", u.Scheme)
+		}
+	}
+
+	if m.Qos < 0 || m.Qos > 2 {
+		p.add("mqtt.qos", "must be 0, 1 or 2, got %d", m.Qos)
+	}
+	if m.TopicPrefix == "" {
+		p.add("mqtt.topic_prefix", "required")
+	}
+	topics := map[string]string{
+		"mqtt.topic_prefix":     m.TopicPrefix,
+		"mqtt.discovery_prefix": m.DiscoveryPrefix,
+	}
+	for _, key := range sortedKeys(topics) {
+		if strings.ContainsAny(topics[key], "+#") || strings.HasPrefix(topics[key], "/") || strings.HasSuffix(topics[key], "/") {
+			p.add(key, "invalid topic %q (no wildcards or leading/trailing /)", topics[key])
+		}
+	}
+	if m.NodeId != "" && !nodeIdPattern.MatchString(m.NodeId) {
+		p.add("mqtt.node_id", "invalid value %q (letters, digits, _ and - only)", m.NodeId)
+	}
+}
+
+func validateMetricsPush(m MetricsPushConfig, p *problems) {
+	if m.PushgatewayUrl == "" && m.RemoteWriteUrl == "" {
+		return
+	}
+
+	urls := map[string]string{
+		"metrics_push.pushgateway_url":  m.PushgatewayUrl,
+		"metrics_push.remote_write_url": m.RemoteWriteUrl,
+	}
+	for _, key := range sortedKeys(urls) {
+		if urls[key] == "" {
+			continue
+		}
+		if u, err := url.Parse(urls[key]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add(key, "invalid URL %q (expected http:// or https://)", urls[key])
+		}
+	}
+
+	if m.Interval <= 0 {
+		p.add("metrics_push.interval", "must be positive, got %s", m.Interval)
+	}
+	if m.Timeout <= 0 {
+		p.add("metrics_push.timeout", "must be positive, got %s", m.Timeout)
+	}
+	if m.Retries < 0 {
+		p.add("metrics_push.retries", "must not be negative, got %d", m.Retries)
+	}
+	if strings.TrimSpace(m.Job) == "" {
+		p.add("metrics_push.job", "required")
+	}
+	for _, name := range sortedKeys(m.Labels) {
+		if !labelPattern.MatchString(name) || strings.HasPrefix(name, "__") || name == "job" {
+			p.add("metrics_push.labels."+name, "invalid label name %q", name)
+		}
+	}
+	if m.BearerToken != "" && (m.Username != "" || m.Password != "") {
+		p.add("metrics_push.bearer_token", "can't be combined with username and password")
+	}
+}
+
+func validateInfluxdb(c InfluxdbConfig, p *problems) {
+	if c.Url == "" {
+		return
+	}
+
+	u, err := url.Parse(c.Url)
+	switch {
+	case err != nil || u.Host == "":
+		p.add("influxdb.url", "invalid URL %q (expected http://, https:// or udp://host:port)", c.Url)
+	case u.Scheme == "udp":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			p.add("influxdb.url", "udp URL needs a port, e.g. udp://localhost:8089")
+		}
+	case u.Scheme != "http" && u.Scheme != "https":
+		p.add("influxdb.url", "unsupported scheme %q (expected http, https or udp)", u.Scheme)
+	case c.Version == 1:
+		if c.Database == "" {
+			p.add("influxdb.database", "required for version 1")
+		}
+	case c.Version == 2:
+		if c.Org == "" {
+			p.add("influxdb.org", "required for version 2")
+		}
+		if c.Bucket == "" {
+			p.add("influxdb.bucket", "required for version 2")
+		}
+	default:
+		p.add("influxdb.version", "must be 1 or 2, got %d", c.Version)
+	}
+
+	if c.BatchSize <= 0 {
+		p.add("influxdb.batch_size", "must be positive, got %d", c.BatchSize)
+	}
+	if c.FlushInterval <= 0 {
+		p.add("influxdb.flush_interval", "must be positive, got %s", c.FlushInterval)
+	}
+	if c.Timeout <= 0 {
+		p.add("influxdb.timeout", "must be positive, got %s", c.Timeout)
+	}
+	if c.Retries < 0 {
+		p.add("influxdb.retries", "must not be negative, got %d", c.Retries)
+	}
+	measurements := map[string]string{
+		"influxdb.disk_measurement":      c.DiskMeasurement,
+		"influxdb.speedtest_measurement": c.SpeedTestMeasurement,
+	}
+	for _, key := range sortedKeys(measurements) {
+		if strings.TrimSpace(measurements[key]) == "" {
+			p.add(key, "required")
+		}
+	}
+	for _, name := range sortedKeys(c.Tags) {
+		if strings.HasPrefix(name, "_") {
+			p.add("influxdb.tags."+name, "tag names starting with _ are reserved")
+		}
+	}
+}
+
+func validateOtel(c OtelConfig, p *problems) {
+	if c.Endpoint == "" {
+		return
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	switch {
+	case err != nil || u.Host == "":
+		p.add("otel.endpoint", "invalid URL %q (expected http://host:port or https://host:port)", c.Endpoint)
+	case u.Scheme != "http" && u.Scheme != "https":
+		p.add("otel.endpoint", "unsupported scheme %q (expected http or https)", u.Scheme)
+	}
+	if c.Protocol != "http/protobuf" && c.Protocol != "grpc" {
+		p.add("otel.protocol", "invalid protocol %q (expected http/protobuf or grpc)", c.Protocol)
+	}
+	if strings.TrimSpace(c.ServiceName) == "" {
+		p.add("otel.service_name", "required")
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		p.add("otel.sample_ratio", "must be between 0 and 1, got %g", c.SampleRatio)
+	}
+	if c.Metrics && c.MetricsInterval <= 0 {
+		p.add("otel.metrics_interval", "must be positive, got %s", c.MetricsInterval)
+	}
+}
+
+// validateListen accepts host:port with a numeric port, or unix:/path.
+func validateListen(addr string) error {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return fmt.Errorf("unix socket path is empty")
+		}
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q (expected host:port or unix:/path)", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q in %q", port, addr)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
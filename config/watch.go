@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// reloadDelay collapses the burst of events editors and ConfigMap updates
+// produce into a single reload.
+const reloadDelay = 500 * time.Millisecond
+
+// Watch reloads the configuration from path whenever one of files changes on
+// disk or the process receives SIGHUP, until ctx is done. A config that
+// loads and validates is passed to apply; otherwise reject gets the error and
+// the active config stays in place. Files added by a reload, such as a new
+// include, are watched from the next restart.
+func Watch(ctx context.Context, l *zerolog.Logger, path string, files []string, apply func(*Config), reject func(error)) {
+	logger := l.With().Str("type", "config").Logger()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var watcher *fsnotify.Watcher
+	var fsEvents <-chan fsnotify.Event
+	var fsErrors <-chan error
+	watched := map[string]bool{}
+	if len(files) > 0 {
+		var err error
+		watcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			logger.Err(err).Msg("Failed to watch config files, reload with SIGHUP only")
+		} else {
+			fsEvents, fsErrors = watcher.Events, watcher.Errors
+		}
+	}
+	for _, file := range files {
+		if watcher == nil {
+			break
+		}
+		// Watch the directory: editors and Kubernetes replace the file
+		// rather than writing to it.
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			logger.Err(err).Str("file", file).Msg("Failed to watch config file, reload with SIGHUP")
+			continue
+		}
+		watched[filepath.Clean(file)] = true
+		logger.Info().Str("file", file).Msg("Watching config file")
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		if watcher != nil {
+			defer watcher.Close()
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		reload := func(reason string) {
+			logger.Info().Str("reason", reason).Msg("Reloading config")
+			next, err := Load(path)
+			if err != nil {
+				logger.Err(err).Msg("Config reload rejected, keeping the current config")
+				reject(err)
+				return
+			}
+			apply(next)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reload("SIGHUP")
+			case ev := <-fsEvents:
+				if !watched[filepath.Clean(ev.Name)] && filepath.Base(ev.Name) != "..data" {
+					continue
+				}
+				if timer == nil {
+					timer = time.NewTimer(reloadDelay)
+				} else {
+					timer.Reset(reloadDelay)
+				}
+				due = timer.C
+			case err := <-fsErrors:
+				logger.Err(err).Msg("Config watcher error")
+			case <-due:
+				due = nil
+				reload("file changed")
+			}
+		}
+	}()
+}
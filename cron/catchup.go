@@ -0,0 +1,125 @@
+package cron
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	catchUpTick = time.Minute
+	// maxCatchUpSteps bounds the walk over missed fire times for very
+	// frequent schedules after a long downtime.
+	maxCatchUpSteps = 100000
+)
+
+type scheduledJob struct {
+	def      job.Definition
+	schedule cron.Schedule
+	entry    cron.EntryID
+}
+
+// watchCatchUp runs missed jobs once at startup and again whenever the wall
+// clock jumps ahead of the ticker, which is what a host suspend looks like.
+func (c *Cron) watchCatchUp(ctx context.Context) {
+	c.catchUp(ctx)
+
+	ticker := time.NewTicker(catchUpTick)
+	defer ticker.Stop()
+
+	last := time.Now().Round(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().Round(0)
+			if now.Sub(last) > 2*catchUpTick {
+				c.logger.Warn().Dur("gap", now.Sub(last)).Msg("Clock jumped, checking for missed jobs")
+				c.catchUp(ctx)
+			}
+			last = now
+		}
+	}
+}
+
+func (c *Cron) catchUp(ctx context.Context) {
+	cfg := c.config.Get()
+	if cfg.CatchUpWindow <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	scheduled := append([]scheduledJob(nil), c.scheduled...)
+	c.mu.Unlock()
+
+	now := time.Now()
+	for _, sj := range scheduled {
+		missed, ok := c.missedRun(sj, now)
+		if !ok {
+			continue
+		}
+
+		c.logger.Info().Str("job", sj.def.Name).Time("missed_at", missed).Msg("Catching up missed job")
+		go c.runCatchUp(ctx, sj, missed)
+	}
+}
+
+// missedRun returns the latest fire time of sj after its last recorded run,
+// if that time has passed and is still inside the catch-up window. With more
+// than maxCatchUpSteps fire times in the window it returns the last one
+// walked, which is missed all the same.
+func (c *Cron) missedRun(sj scheduledJob, now time.Time) (time.Time, bool) {
+	last, ok := c.store.LastScheduledRun(sj.def.Name)
+	if !ok {
+		// Nothing to compare against yet; start tracking from now
+		c.store.RecordScheduledRun(sj.def.Name, now)
+		return time.Time{}, false
+	}
+
+	// Fire times before the window don't count, so walk from its start
+	from := last
+	if start := now.Add(-c.config.Get().CatchUpWindow); start.After(from) {
+		from = start
+	}
+
+	var missed time.Time
+	next := sj.schedule.Next(from)
+	for i := 0; !next.After(now); i++ {
+		if i == maxCatchUpSteps {
+			// Every step so far was a missed run inside the window
+			c.logger.Warn().Str("job", sj.def.Name).Time("reached", missed).Int("steps", maxCatchUpSteps).Msg("Too many missed fire times to walk, catching up from the last one reached")
+			break
+		}
+		missed = next
+		next = sj.schedule.Next(next)
+	}
+
+	if missed.IsZero() {
+		return time.Time{}, false
+	}
+	return missed, true
+}
+
+func (c *Cron) runCatchUp(ctx context.Context, sj scheduledJob, missed time.Time) {
+	if jitter := c.config.Get().CatchUpJitter; jitter > 0 {
+		delay := rand.N(jitter)
+		c.logger.Debug().Str("job", sj.def.Name).Dur("delay", delay).Msg("Delaying catch-up run")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	// The scheduler may have fired the job itself meanwhile
+	if last, ok := c.store.LastScheduledRun(sj.def.Name); ok && !last.Before(missed) {
+		return
+	}
+
+	c.store.RecordScheduledRun(sj.def.Name, time.Now())
+	c.executor.Run(context.Background(), sj.def, c.deps(job.TriggerCatchUp))
+}
@@ -1,75 +1,122 @@
 package cron
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/koss-shtukert/servers-stats/config"
 	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
 )
 
 type Cron struct {
-	cron   *cron.Cron
-	tgBot  *bot.Bot
-	logger *zerolog.Logger
-	config *config.Config
+	cron     *cron.Cron
+	tgBot    *bot.Bot
+	store    *store.Store
+	executor *job.Executor
+	logger   *zerolog.Logger
+	config   *config.Live
+	// mu guards scheduled, the jobs added to cron, kept for missed-run
+	// catch-up and for removal on reload
+	mu        sync.Mutex
+	scheduled []scheduledJob
+	cancel    context.CancelFunc
+	running   atomic.Bool
 }
 
-func NewCron(l *zerolog.Logger, cfg *config.Config, b *bot.Bot) *Cron {
+func NewCron(l *zerolog.Logger, cfg *config.Live, b *bot.Bot, st *store.Store, ex *job.Executor) *Cron {
 	logger := l.With().Str("type", "cron").Logger()
 
 	c := &Cron{
-		cron:   cron.New(),
-		tgBot:  b,
-		logger: &logger,
-		config: cfg,
+		cron:     cron.New(cron.WithParser(common.ScheduleParser)),
+		tgBot:    b,
+		store:    st,
+		executor: ex,
+		logger:   &logger,
+		config:   cfg,
 	}
 
 	return c
 }
 
-func (c *Cron) AddMotioneyeDiskUsageJob() {
-	if _, err := c.cron.AddFunc(c.config.CronMotioneyeDiskUsageJobInterval, job.MotioneyeDiskUsageJob(c.logger, c.config, c.tgBot)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule MotioneyeDiskUsage job")
+func (c *Cron) AddJobs() {
+	cfg := c.config.Get()
+	for _, def := range job.Definitions() {
+		if def.Schedule == nil || !def.Enabled(cfg) {
+			continue
+		}
+		c.AddJob(def)
 	}
 }
 
-func (c *Cron) AddPlexDiskUsageJob() {
-	if _, err := c.cron.AddFunc(c.config.CronPlexDiskUsageJobInterval, job.PlexDiskUsageJob(c.logger, c.config, c.tgBot)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule PlexDiskUsage job")
+// Reschedule replaces every scheduled job with the ones enabled in the
+// current config. Runs in progress are not affected.
+func (c *Cron) Reschedule() {
+	c.mu.Lock()
+	for _, sj := range c.scheduled {
+		c.cron.Remove(sj.entry)
 	}
-}
+	c.scheduled = nil
+	c.mu.Unlock()
 
-func (c *Cron) AddServerDiskUsageJob() {
-	if _, err := c.cron.AddFunc(c.config.CronServerDiskUsageJobInterval, job.ServerDiskUsageJob(c.logger, c.config, c.tgBot)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule ServerDiskUsage job")
-	}
+	c.AddJobs()
 }
 
-func (c *Cron) AddSpeedTestJob() {
-	if _, err := c.cron.AddFunc(c.config.CronSpeedTestJobInterval, job.SpeedTestJob(c.logger, c.config, c.tgBot)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule SpeedTest job")
+func (c *Cron) AddJob(def job.Definition) {
+	runner := func() {
+		c.store.RecordScheduledRun(def.Name, time.Now())
+		c.executor.Run(context.Background(), def, c.deps(job.TriggerCron))
 	}
-}
 
-func (c *Cron) AddMotioneyeMetricsJob() {
-	if _, err := c.cron.AddFunc(c.config.CronMotioneyeMetricsJobInterval, job.MotioneyeMetricsJob(c.logger, c.config)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule MotioneyeMetrics job")
+	spec := def.Schedule(c.config.Get())
+	schedule, err := common.ParseSchedule(spec)
+	if err != nil {
+		c.logger.Err(err).Str("job", def.Name).Str("schedule", spec).Msg("Failed to schedule job")
+		return
 	}
-}
 
-func (c *Cron) AddServerMetricsJob() {
-	if _, err := c.cron.AddFunc(c.config.CronServerMetricsJobInterval, job.ServerMetricsJob(c.logger, c.config)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule ServerMetrics job")
-	}
+	c.mu.Lock()
+	entry := c.cron.Schedule(schedule, cron.FuncJob(runner))
+	c.scheduled = append(c.scheduled, scheduledJob{def: def, schedule: schedule, entry: entry})
+	c.mu.Unlock()
+	c.logger.Info().Str("job", def.Name).Str("schedule", spec).Time("next_run", schedule.Next(time.Now())).Msg("Job scheduled")
 }
 
-func (c *Cron) AddPlexMetricsJob() {
-	if _, err := c.cron.AddFunc(c.config.CronPlexMetricsJobInterval, job.PlexMetricsJob(c.logger, c.config)); err != nil {
-		c.logger.Err(err).Msg("Failed to schedule PlexMetrics job")
+func (c *Cron) deps(trigger string) job.Deps {
+	return job.Deps{
+		Logger:   c.logger,
+		Config:   c.config.Get(),
+		Store:    c.store,
+		Notifier: c.tgBot,
+		Trigger:  trigger,
 	}
 }
 
 func (c *Cron) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
 	c.cron.Start()
+	c.running.Store(true)
+	go c.watchCatchUp(ctx)
+}
+
+func (c *Cron) Running() bool {
+	return c.running.Load()
+}
+
+// Stop halts the scheduler; the returned context is done once jobs started
+// by cron have returned.
+func (c *Cron) Stop() context.Context {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.running.Store(false)
+	return c.cron.Stop()
 }
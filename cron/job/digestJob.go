@@ -0,0 +1,96 @@
+package job
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/digest"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	Register(Definition{
+		Name:        "digest",
+		Title:       "Daily digest",
+		Description: "Show daily digest",
+		Command:     true,
+		Timeout:     time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_daily_digest_job", Default: false},
+			{Key: "cron_daily_digest_job_interval", Default: "0 9 * * *"},
+			{Key: "digest_sections", Default: digest.DefaultSections},
+			{Key: "digest_notifier", Default: "telegram"},
+			{Key: "digest_suppress_ok_messages", Default: false},
+		},
+		EnabledKey:  "cron_run_daily_digest_job",
+		ScheduleKey: "cron_daily_digest_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunDailyDigestJob },
+		Schedule:    func(c *config.Config) string { return c.CronDailyDigestJobInterval },
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(DigestJob(d.Logger, d.Config, d.Store, digestNotifier(d), digest.Daily))
+		},
+	})
+
+	Register(Definition{
+		Name:        "weekly_digest",
+		Title:       "Weekly digest",
+		Description: "Show weekly digest",
+		Command:     true,
+		Timeout:     time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_weekly_digest_job", Default: false},
+			{Key: "cron_weekly_digest_job_interval", Default: "0 9 * * 1"},
+		},
+		EnabledKey:  "cron_run_weekly_digest_job",
+		ScheduleKey: "cron_weekly_digest_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunWeeklyDigestJob },
+		Schedule:    func(c *config.Config) string { return c.CronWeeklyDigestJobInterval },
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(DigestJob(d.Logger, d.Config, d.Store, digestNotifier(d), digest.Weekly))
+		},
+	})
+}
+
+func DigestJob(l *zerolog.Logger, c *config.Config, st *store.Store, n common.Notifier, kind string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		logger := l.With().Str("type", "DigestJob").Str("kind", kind).Logger()
+		logger.Debug().Msg("Starting")
+
+		msg := digest.Build(st, kind, c.DigestSections, time.Now())
+		n.SendMessage(msg)
+
+		logger.Info().Msg("Digest sent")
+		logger.Debug().Msg("Finished")
+		return msg, nil
+	}
+}
+
+// digestNotifier routes scheduled digests to the configured destination;
+// on-demand digests always answer in the chat that asked for them.
+func digestNotifier(d Deps) common.Notifier {
+	if !d.Scheduled() {
+		return d.Notifier
+	}
+
+	if d.Config.DigestNotifier == "log" {
+		return common.LogNotifier{Logger: d.Logger}
+	}
+
+	cn, ok := d.Notifier.(common.ChatNotifier)
+	if !ok || strings.TrimSpace(d.Config.DigestTgBotChatId) == "" || d.Config.UsesTestChat() {
+		return d.Notifier
+	}
+
+	chatId, err := strconv.ParseInt(d.Config.DigestTgBotChatId, 10, 64)
+	if err != nil {
+		d.Logger.Err(err).Str("chat_id", d.Config.DigestTgBotChatId).Msg("Invalid digest chat id, using default chat")
+		return d.Notifier
+	}
+
+	return common.ChatNotifierFor(cn, chatId)
+}
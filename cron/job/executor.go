@@ -0,0 +1,313 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/metrics"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/koss-shtukert/servers-stats/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeTimeout = "timeout"
+	OutcomeSkipped = "skipped"
+)
+
+var (
+	errShuttingDown   = errors.New("shutting down")
+	errAlreadyRunning = errors.New("already running")
+)
+
+type runState struct {
+	slot    chan struct{}
+	waiting bool
+}
+
+// Executor is the single concurrency guard shared by cron, bot and REST
+// triggers: one run per job at a time, with an optional queued follow-up.
+type Executor struct {
+	logger *zerolog.Logger
+	config *config.Live
+	store  *store.Store
+	events *events.Bus
+	mu     sync.Mutex
+	states map[string]*runState
+	closed bool
+	active sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewExecutor(l *zerolog.Logger, c *config.Live, st *store.Store, ev *events.Bus) *Executor {
+	logger := l.With().Str("type", "executor").Logger()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Executor{
+		logger: &logger,
+		config: c,
+		store:  st,
+		events: ev,
+		states: make(map[string]*runState),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (e *Executor) Options(def Definition) (time.Duration, string) {
+	timeout, overlap := def.Timeout, def.Overlap
+	if opts, ok := e.config.Get().Jobs[def.Name]; ok {
+		if opts.Timeout > 0 {
+			timeout = opts.Timeout
+		}
+		if opts.Overlap != "" {
+			overlap = opts.Overlap
+		}
+	}
+	if overlap == "" {
+		overlap = OverlapSkip
+	}
+	return timeout, overlap
+}
+
+// Busy reports whether a new run of def would be skipped right now.
+func (e *Executor) Busy(def Definition) bool {
+	_, overlap := e.Options(def)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rs := e.state(def.Name)
+	if len(rs.slot) == 0 {
+		return false
+	}
+	return overlap == OverlapSkip || rs.waiting
+}
+
+// Close stops accepting new runs; runs already started or queued continue.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	e.closed = true
+	e.mu.Unlock()
+}
+
+func (e *Executor) Closed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.closed
+}
+
+// Wait blocks until in-flight runs finish or ctx is done. On timeout it
+// returns the names of the jobs that were still running.
+func (e *Executor) Wait(ctx context.Context) []string {
+	done := make(chan struct{})
+	go func() {
+		e.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return e.RunningJobs()
+	}
+}
+
+// Cancel aborts in-flight runs through their context.
+func (e *Executor) Cancel() {
+	e.cancel()
+}
+
+func (e *Executor) RunningJobs() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var names []string
+	for name, rs := range e.states {
+		if len(rs.slot) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Executor) Running(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.state(name).slot) > 0
+}
+
+type jobEvent struct {
+	Job             string    `json:"job"`
+	Trigger         string    `json:"trigger"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`
+	Outcome         string    `json:"outcome,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+type RunResult struct {
+	Outcome   string
+	Result    any
+	Err       error
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// Run executes def unless it is already running. With the queue policy a
+// single follow-up run waits for the current one; further triggers are
+// skipped with OutcomeSkipped.
+func (e *Executor) Run(ctx context.Context, def Definition, d Deps) RunResult {
+	timeout, overlap := e.Options(def)
+
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		e.logger.Warn().Str("job", def.Name).Str("trigger", d.Trigger).Msg("Shutting down, not starting job")
+		return RunResult{Outcome: OutcomeSkipped, Err: errShuttingDown, StartedAt: time.Now()}
+	}
+	rs := e.state(def.Name)
+	e.active.Add(1)
+	e.mu.Unlock()
+	defer e.active.Done()
+
+	select {
+	case rs.slot <- struct{}{}:
+	default:
+		if !e.enqueue(rs, overlap) {
+			metrics.JobSkippedTotal.WithLabelValues(def.Name).Inc()
+			e.logger.Warn().Str("job", def.Name).Str("trigger", d.Trigger).Msg("Job already running, skipping")
+			res := RunResult{Outcome: OutcomeSkipped, Err: errAlreadyRunning, StartedAt: time.Now()}
+			e.record(def.Name, d.Trigger, res)
+			return res
+		}
+
+		e.logger.Info().Str("job", def.Name).Str("trigger", d.Trigger).Msg("Job already running, queued")
+		select {
+		case rs.slot <- struct{}{}:
+			e.dequeue(rs)
+		case <-ctx.Done():
+			e.dequeue(rs)
+			return RunResult{Outcome: OutcomeSkipped, Err: ctx.Err(), StartedAt: time.Now()}
+		}
+	}
+	defer func() { <-rs.slot }()
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	stop := context.AfterFunc(e.ctx, cancel)
+	defer stop()
+
+	if d.Events == nil {
+		d.Events = e.events
+	}
+
+	spanCtx, span := tracing.Start(runCtx, "job "+def.Name, attribute.String("job", def.Name), attribute.String("trigger", d.Trigger))
+	d.Logger = tracing.Logger(spanCtx, d.Logger)
+	d.Notifier = common.NotifierWithContext(spanCtx, d.Notifier)
+
+	res := RunResult{Outcome: OutcomeSuccess, StartedAt: time.Now()}
+	e.events.Publish(events.JobStarted, jobEvent{Job: def.Name, Trigger: d.Trigger, StartedAt: res.StartedAt})
+	res.Result, res.Err = def.Runner(d)(spanCtx)
+	res.Duration = time.Since(res.StartedAt)
+
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		res.Outcome = OutcomeTimeout
+		if res.Err == nil {
+			res.Err = fmt.Errorf("timed out after %s", timeout)
+		}
+		metrics.JobTimeoutsTotal.WithLabelValues(def.Name).Inc()
+		e.logger.Error().Str("job", def.Name).Dur("timeout", timeout).Msg("Job timed out")
+	case res.Err != nil:
+		res.Outcome = OutcomeFailure
+	}
+	span.SetAttributes(attribute.String("outcome", res.Outcome))
+	tracing.End(span, res.Err)
+
+	e.record(def.Name, d.Trigger, res)
+
+	return res
+}
+
+func (e *Executor) record(name, trigger string, res RunResult) {
+	run := store.JobRun{
+		Job:       name,
+		Trigger:   trigger,
+		StartedAt: res.StartedAt,
+		Duration:  res.Duration,
+		Outcome:   res.Outcome,
+	}
+	if res.Err != nil {
+		run.Error = res.Err.Error()
+		if res.Outcome != OutcomeSkipped {
+			e.store.RecordJobFailure(name, res.Err)
+		}
+	}
+
+	e.store.RecordJobRun(run)
+	e.events.Publish(events.JobFinished, jobEvent{
+		Job:             name,
+		Trigger:         trigger,
+		StartedAt:       res.StartedAt,
+		DurationSeconds: res.Duration.Seconds(),
+		Outcome:         res.Outcome,
+		Error:           run.Error,
+	})
+	metrics.RecordJobRun(name, res.Outcome, res.Duration, res.StartedAt.Add(res.Duration))
+}
+
+func (e *Executor) enqueue(rs *runState, overlap string) bool {
+	if overlap != OverlapQueue {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if rs.waiting {
+		return false
+	}
+	rs.waiting = true
+	return true
+}
+
+func (e *Executor) dequeue(rs *runState) {
+	e.mu.Lock()
+	rs.waiting = false
+	e.mu.Unlock()
+}
+
+// state returns the run state for name. Must be called with e.mu held.
+func (e *Executor) state(name string) *runState {
+	rs, ok := e.states[name]
+	if !ok {
+		rs = &runState{slot: make(chan struct{}, 1)}
+		e.states[name] = rs
+	}
+	return rs
+}
@@ -1,25 +1,49 @@
 package job
 
 import (
+	"context"
+	"time"
+
 	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/koss-shtukert/servers-stats/config"
 	"github.com/koss-shtukert/servers-stats/metrics"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/rs/zerolog"
 )
 
-func MotioneyeMetricsJob(l *zerolog.Logger, c *config.Config) func() {
-	return func() {
+func init() {
+	Register(Definition{
+		Name:    "motioneye_metrics",
+		Timeout: time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_motioneye_metrics_job", Default: false},
+		},
+		EnabledKey:  "cron_run_motioneye_metrics_job",
+		ScheduleKey: "cron_motioneye_metrics_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunMotioneyeMetricsJob },
+		Schedule:    func(c *config.Config) string { return c.CronMotioneyeMetricsJobInterval },
+		Path:        func(c *config.Config) string { return c.CronMotioneyeDiskUsageJobPath },
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(MotioneyeMetricsJob(d.Logger, d.Config, d.Store))
+		},
+	})
+}
+
+func MotioneyeMetricsJob(l *zerolog.Logger, c *config.Config, st *store.Store) func(ctx context.Context) (*common.DiskUsageResult, error) {
+	return func(ctx context.Context) (*common.DiskUsageResult, error) {
 		logger := l.With().Str("type", "MotioneyeMetricsJob").Logger()
 		logger.Debug().Msg("Starting")
 
-		result, err := common.GetDiskUsage(&logger, c.CronMotioneyeDiskUsageJobPath)
+		result, err := common.GetDiskUsage(ctx, &logger, c.CronMotioneyeDiskUsageJobPath)
 		if err != nil {
 			logger.Err(err).Msg("Failed to get disk usage")
-			return
+			return nil, err
 		}
 
 		metrics.RecordDiskUsageDetailed(c.CronMotioneyeDiskUsageJobPath, "motioneye", result.Percentage, result.UsedBytes, result.AvailBytes)
+		recordDiskSample(st, "motioneye", c.CronMotioneyeDiskUsageJobPath, result)
 		logger.Info().Str("used", result.Used).Str("avail", result.Available).Str("usage", result.UsageStr).Int("percentage", result.Percentage).Msg("Motioneye disk usage metrics recorded")
 		logger.Debug().Msg("Finished")
+		return result, nil
 	}
 }
@@ -1,25 +1,62 @@
 package job
 
 import (
+	"context"
+	"time"
+
 	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/rs/zerolog"
 )
 
-func PlexDiskUsageJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func() {
-	return func() {
+func init() {
+	Register(Definition{
+		Name:        "plex_disk_usage",
+		Title:       "Plex disk usage check",
+		Description: "Show Plex disk usage",
+		Route:       "/plex-disk-usage",
+		Command:     true,
+		Timeout:     time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_plex_disk_usage_job", Default: false},
+		},
+		EnabledKey:  "cron_run_plex_disk_usage_job",
+		ScheduleKey: "cron_plex_disk_usage_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunPlexDiskUsageJob },
+		Schedule:    func(c *config.Config) string { return c.CronPlexDiskUsageJobInterval },
+		Path:        func(c *config.Config) string { return c.CronPlexDiskUsageJobPath },
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(PlexDiskUsageJob(d.Logger, d.Config, d.Store, d.Notifier, d.Scheduled()))
+		},
+	})
+}
+
+func PlexDiskUsageJob(l *zerolog.Logger, c *config.Config, st *store.Store, n common.Notifier, scheduled bool) func(ctx context.Context) (*common.DiskUsageResult, error) {
+	return func(ctx context.Context) (*common.DiskUsageResult, error) {
 		logger := l.With().Str("type", "PlexDiskUsageJob").Logger()
 		logger.Debug().Msg("Starting")
 
-		result, err := common.GetDiskUsage(&logger, c.CronPlexDiskUsageJobPath)
+		result, err := common.GetDiskUsage(ctx, &logger, c.CronPlexDiskUsageJobPath)
 		if err != nil {
 			logger.Err(err).Msg("Failed to get disk usage")
 			n.SendMessage("⚠️ Plex: failed to check disk usage")
-			return
+			return nil, err
 		}
 
 		logger.Info().Str("used", result.Used).Str("available", result.Available).Str("usage", result.UsageStr).Int("percentage", result.Percentage).Msg("Disk usage retrieved successfully")
+		recordDiskSample(st, "plex", c.CronPlexDiskUsageJobPath, result)
+
+		if scheduled && c.DigestSuppressOkMessages && common.DiskUsageStatus(result.Percentage) == common.StatusOK {
+			logger.Debug().Msg("Disk usage OK, leaving it to the digest")
+			return result, nil
+		}
+		if scheduled && st.Silenced("disk:plex") {
+			logger.Debug().Msg("Silenced, not notifying")
+			return result, nil
+		}
 		n.SendMessage(common.FormatDiskUsageMessage("Plex", result.Used, result.Available, result.UsageStr, result.Percentage))
 		logger.Debug().Msg("Finished")
+		return result, nil
 	}
 }
@@ -0,0 +1,22 @@
+package job
+
+import (
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+func recordDiskSample(st *store.Store, name, path string, r *common.DiskUsageResult) {
+	st.RecordDiskSample(store.DiskSample{
+		Name:          name,
+		Path:          path,
+		Percentage:    r.Percentage,
+		UsedBytes:     r.UsedBytes,
+		AvailBytes:    r.AvailBytes,
+		InodesTotal:   r.InodesTotal,
+		InodesUsed:    r.InodesUsed,
+		InodesPercent: r.InodesPercent,
+		SampledAt:     time.Now(),
+	}, common.DiskUsageStatus(r.Percentage))
+}
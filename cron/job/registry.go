@@ -0,0 +1,127 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+const (
+	TriggerCron    = "cron"
+	TriggerCatchUp = "catchup"
+	TriggerBot     = "bot"
+	TriggerAPI     = "api"
+	TriggerMQTT    = "mqtt"
+	// TriggerOnce runs jobs from "run --once" outside the daemon.
+	TriggerOnce = "once"
+)
+
+type Deps struct {
+	Logger   *zerolog.Logger
+	Config   *config.Config
+	Store    *store.Store
+	Notifier common.Notifier
+	Trigger  string
+	// Events is filled in by the executor for jobs reporting progress.
+	Events *events.Bus
+}
+
+func (d Deps) Scheduled() bool {
+	return d.Trigger == TriggerCron || d.Trigger == TriggerCatchUp
+}
+
+type Setting struct {
+	Key     string
+	Default any
+}
+
+type Definition struct {
+	// Name doubles as the bot command and the rate limiting key.
+	Name        string
+	Title       string
+	Description string
+	// Route is the REST path triggering the job, empty if not exposed.
+	Route string
+	// Command exposes the job as a bot command.
+	Command      bool
+	StartMessage string
+	Cooldown     time.Duration
+	// Timeout and Overlap are defaults, overridable per job under jobs.<name>.
+	Timeout  time.Duration
+	Overlap  string
+	Settings []Setting
+	// EnabledKey and ScheduleKey name the config keys behind Enabled and
+	// Schedule so config.Load can validate them.
+	EnabledKey  string
+	ScheduleKey string
+	Enabled     func(c *config.Config) bool
+	Schedule    func(c *config.Config) string
+	// Path is the filesystem path the job inspects, checked for readiness.
+	Path   func(c *config.Config) string
+	Runner func(d Deps) func(ctx context.Context) (any, error)
+}
+
+var (
+	registryMu  sync.RWMutex
+	definitions []Definition
+)
+
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, d := range definitions {
+		if d.Name == def.Name {
+			panic(fmt.Sprintf("job %q registered twice", def.Name))
+		}
+	}
+
+	config.RegisterJob(def.Name)
+	for _, s := range def.Settings {
+		config.RegisterDefault(s.Key, s.Default)
+	}
+	if def.ScheduleKey != "" {
+		config.RegisterSchedule(def.ScheduleKey, def.EnabledKey)
+	}
+
+	definitions = append(definitions, def)
+}
+
+func Definitions() []Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	out := make([]Definition, len(definitions))
+	copy(out, definitions)
+	return out
+}
+
+func Lookup(name string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, d := range definitions {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// adapt erases the result type of a job function so it fits Runner.
+func adapt[T any](fn func(ctx context.Context) (T, error)) func(ctx context.Context) (any, error) {
+	return func(ctx context.Context) (any, error) {
+		result, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
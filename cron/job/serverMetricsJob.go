@@ -1,29 +1,57 @@
 package job
 
 import (
+	"context"
+	"time"
+
 	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/koss-shtukert/servers-stats/config"
 	"github.com/koss-shtukert/servers-stats/metrics"
+	"github.com/koss-shtukert/servers-stats/store"
 	"github.com/rs/zerolog"
 )
 
-func ServerMetricsJob(l *zerolog.Logger, c *config.Config) func() {
-	return func() {
+func init() {
+	Register(Definition{
+		Name:    "server_metrics",
+		Timeout: time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_server_metrics_job", Default: false},
+		},
+		EnabledKey:  "cron_run_server_metrics_job",
+		ScheduleKey: "cron_server_metrics_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunServerMetricsJob },
+		Schedule:    func(c *config.Config) string { return c.CronServerMetricsJobInterval },
+		Path:        serverMetricsPath,
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(ServerMetricsJob(d.Logger, d.Config, d.Store))
+		},
+	})
+}
+
+func ServerMetricsJob(l *zerolog.Logger, c *config.Config, st *store.Store) func(ctx context.Context) (*common.DiskUsageResult, error) {
+	return func(ctx context.Context) (*common.DiskUsageResult, error) {
 		logger := l.With().Str("type", "ServerMetricsJob").Logger()
 		logger.Debug().Msg("Starting")
 
-		path := c.CronServerDiskUsageJobPath
-		if path == "" {
-			path = "/"
-		}
-		result, err := common.GetDiskUsage(&logger, path)
+		path := serverMetricsPath(c)
+		result, err := common.GetDiskUsage(ctx, &logger, path)
 		if err != nil {
 			logger.Err(err).Msg("Failed to get disk usage")
-			return
+			return nil, err
 		}
 
 		metrics.RecordDiskUsageDetailed(path, "server", result.Percentage, result.UsedBytes, result.AvailBytes)
+		recordDiskSample(st, "server", path, result)
 		logger.Info().Str("used", result.Used).Str("avail", result.Available).Str("usage", result.UsageStr).Int("percentage", result.Percentage).Msg("Server disk usage metrics recorded")
 		logger.Debug().Msg("Finished")
+		return result, nil
+	}
+}
+
+func serverMetricsPath(c *config.Config) string {
+	if c.CronServerDiskUsageJobPath == "" {
+		return "/"
 	}
+	return c.CronServerDiskUsageJobPath
 }
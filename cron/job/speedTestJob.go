@@ -8,30 +8,63 @@ import (
 
 	"github.com/koss-shtukert/servers-stats/common"
 	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/koss-shtukert/servers-stats/tracing"
 
 	"github.com/rs/zerolog"
 	"github.com/showwin/speedtest-go/speedtest"
 )
 
-func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func() {
-	return func() {
+func init() {
+	Register(Definition{
+		Name:         "speedtest",
+		Title:        "Speedtest",
+		Description:  "Run speed test",
+		Route:        "/speed-test",
+		Command:      true,
+		StartMessage: "Running speedtest…",
+		Cooldown:     30 * time.Second,
+		Timeout:      2 * time.Minute,
+		Settings: []Setting{
+			{Key: "cron_run_speed_test_job", Default: false},
+		},
+		EnabledKey:  "cron_run_speed_test_job",
+		ScheduleKey: "cron_speed_test_job_interval",
+		Enabled:     func(c *config.Config) bool { return c.CronRunSpeedTestJob },
+		Schedule:    func(c *config.Config) string { return c.CronSpeedTestJobInterval },
+		Runner: func(d Deps) func(ctx context.Context) (any, error) {
+			return adapt(SpeedTestJob(d.Logger, d.Config, d.Store, d.Notifier, d.Events, d.Scheduled()))
+		},
+	})
+}
+
+func SpeedTestJob(l *zerolog.Logger, c *config.Config, st *store.Store, n common.Notifier, ev *events.Bus, scheduled bool) func(ctx context.Context) (*store.SpeedTestSample, error) {
+	return func(ctx context.Context) (*store.SpeedTestSample, error) {
 		logger := l.With().Str("type", "SpeedTestJob").Logger()
 		start := time.Now()
 		logger.Info().Time("start_time", start).Msg("SpeedTest job started")
 
-		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-		defer cancel()
 		defer func() {
 			duration := time.Since(start)
 			logger.Info().Dur("duration", duration).Msg("SpeedTest job completed")
 		}()
 
+		fail := func(err error, msg string) (*store.SpeedTestSample, error) {
+			n.SendMessage(msg)
+			return nil, err
+		}
+
+		phase := func(name, state string, value float64) {
+			ev.Publish(events.SpeedTestPhase, speedTestPhase{Phase: name, State: state, Value: value})
+		}
+
 		speedtest.WithUserConfig(&speedtest.UserConfig{
 			Debug:      true,
 			SavingMode: true,
 		})
 
-		ctxUser, cancelUser := context.WithTimeout(context.Background(), 10*time.Second)
+		ctxUser, cancelUser := context.WithTimeout(ctx, 10*time.Second)
 		defer cancelUser()
 
 		userCh := make(chan *speedtest.User, 1)
@@ -40,7 +73,9 @@ func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func()
 		go func() {
 			logger.Debug().Msg("Starting FetchUserInfo")
 			start := time.Now()
-			u, err := speedtest.FetchUserInfo()
+			spanCtx, span := tracing.Start(ctxUser, "FetchUserInfo")
+			u, err := speedtest.FetchUserInfoContext(spanCtx)
+			tracing.End(span, err)
 			logger.Debug().Dur("fetch_user_duration", time.Since(start)).Msg("FetchUserInfo completed")
 			if err != nil {
 				userErrCh <- err
@@ -53,12 +88,10 @@ func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func()
 		select {
 		case <-ctxUser.Done():
 			logger.Error().Msg("FetchUserInfo timeout")
-			n.SendMessage("⚠️ Speedtest: timeout while fetching network info")
-			return
+			return fail(fmt.Errorf("FetchUserInfo timeout"), "⚠️ Speedtest: timeout while fetching network info")
 		case err := <-userErrCh:
 			logger.Err(err).Msg("FetchUserInfo failed")
-			n.SendMessage("⚠️ Speedtest: failed to fetch network info")
-			return
+			return fail(err, "⚠️ Speedtest: failed to fetch network info")
 		case u := <-userCh:
 			user = u
 		}
@@ -68,7 +101,9 @@ func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func()
 		go func() {
 			logger.Debug().Msg("Starting FetchServers")
 			start := time.Now()
-			servers, err := speedtest.FetchServers()
+			spanCtx, span := tracing.Start(ctx, "FetchServers")
+			servers, err := speedtest.FetchServerListContext(spanCtx)
+			tracing.End(span, err)
 			logger.Debug().Dur("fetch_servers_duration", time.Since(start)).Msg("FetchServers completed")
 			if err != nil {
 				serversErrCh <- err
@@ -81,12 +116,10 @@ func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func()
 		select {
 		case <-ctx.Done():
 			logger.Error().Msg("FetchServers timeout")
-			n.SendMessage("⚠️ Speedtest: timeout while fetching servers")
-			return
+			return fail(fmt.Errorf("FetchServers timeout"), "⚠️ Speedtest: timeout while fetching servers")
 		case err := <-serversErrCh:
 			logger.Err(err).Msg("FetchServers failed")
-			n.SendMessage("⚠️ Speedtest: failed to fetch server list")
-			return
+			return fail(err, "⚠️ Speedtest: failed to fetch server list")
 		case servers = <-serversCh:
 		}
 
@@ -97,46 +130,81 @@ func SpeedTestJob(l *zerolog.Logger, c *config.Config, n common.Notifier) func()
 				err = fmt.Errorf("no server found")
 			}
 			logger.Err(err).Msg("FindServer failed")
-			n.SendMessage("⚠️ Speedtest: no suitable server found")
-			return
+			return fail(err, "⚠️ Speedtest: no suitable server found")
 		}
 		s := targets[0]
 		logger.Info().Str("server_name", s.Name).Str("server_country", s.Country).Str("server_id", s.ID).Msg("Selected speedtest server")
+		ev.Publish(events.SpeedTestPhase, speedTestPhase{Phase: "server", State: "selected", Server: s.Name})
 
 		logger.Debug().Msg("Starting PingTest")
-		if err := runWithTimeout(ctx, logger, "PingTest", func() error {
-			return s.PingTest(nil)
+		phase("ping", "started", 0)
+		if err := runWithTimeout(ctx, logger, "PingTest", func(ctx context.Context) error {
+			return s.PingTestContext(ctx, nil)
 		}); err != nil {
 			logger.Err(err).Msg("PingTest failed")
-			n.SendMessage("⚠️ Speedtest: ping test failed")
-			return
+			return fail(err, "⚠️ Speedtest: ping test failed")
 		}
+		phase("ping", "finished", float64(s.Latency)/float64(time.Millisecond))
 
 		logger.Debug().Msg("Starting DownloadTest")
-		if err := runWithTimeout(ctx, logger, "DownloadTest", func() error {
-			return s.DownloadTest()
+		phase("download", "started", 0)
+		if err := runWithTimeout(ctx, logger, "DownloadTest", func(ctx context.Context) error {
+			return s.DownloadTestContext(ctx)
 		}); err != nil {
 			logger.Err(err).Msg("DownloadTest failed")
-			n.SendMessage("⚠️ Speedtest: download test failed")
-			return
+			return fail(err, "⚠️ Speedtest: download test failed")
 		}
+		phase("download", "finished", s.DLSpeed.Mbps())
 
 		logger.Debug().Msg("Starting UploadTest")
-		if err := runWithTimeout(ctx, logger, "UploadTest", func() error {
-			return s.UploadTest()
+		phase("upload", "started", 0)
+		if err := runWithTimeout(ctx, logger, "UploadTest", func(ctx context.Context) error {
+			return s.UploadTestContext(ctx)
 		}); err != nil {
 			logger.Err(err).Msg("UploadTest failed")
-			n.SendMessage("⚠️ Speedtest: upload test failed")
-			return
+			return fail(err, "⚠️ Speedtest: upload test failed")
+		}
+		phase("upload", "finished", s.ULSpeed.Mbps())
+
+		dlMbps, ulMbps, pingMs := s.DLSpeed.Mbps(), s.ULSpeed.Mbps(), float64(s.Latency)/float64(time.Millisecond)
+		level := speedLevel(dlMbps, ulMbps, pingMs, c)
+		sample := store.SpeedTestSample{
+			DownloadMbps: dlMbps,
+			UploadMbps:   ulMbps,
+			PingMs:       pingMs,
+			Status:       level,
+			ISP:          strings.TrimSpace(user.Isp),
+			Server:       s.Name,
+			SampledAt:    time.Now(),
+		}
+		st.RecordSpeedTest(sample)
+
+		if scheduled && c.DigestSuppressOkMessages && level == common.StatusOK {
+			logger.Debug().Msg("Speedtest OK, leaving it to the digest")
+			return &sample, nil
+		}
+		if scheduled && st.Silenced("speedtest") {
+			logger.Debug().Msg("Silenced, not notifying")
+			return &sample, nil
 		}
 
 		msg := formatSpeedtest(user, s, c)
 		n.SendMessage(msg)
 
 		logger.Debug().Msg("Finished")
+		return &sample, nil
 	}
 }
 
+// speedTestPhase reports progress; Value is the latency in ms for ping and
+// the speed in Mbps for download and upload once the phase has finished.
+type speedTestPhase struct {
+	Phase  string  `json:"phase"`
+	State  string  `json:"state"`
+	Value  float64 `json:"value,omitempty"`
+	Server string  `json:"server,omitempty"`
+}
+
 func formatSpeedtest(user *speedtest.User, s *speedtest.Server, c *config.Config) string {
 	dlMbps := s.DLSpeed.Mbps()
 	ulMbps := s.ULSpeed.Mbps()
@@ -167,24 +235,39 @@ func formatSpeedtest(user *speedtest.User, s *speedtest.Server, c *config.Config
 }
 
 func speedStatus(dlMbps, ulMbps, pingMs float64, c *config.Config) string {
+	switch speedLevel(dlMbps, ulMbps, pingMs, c) {
+	case common.StatusCritical:
+		return "🔴 Poor"
+	case common.StatusWarning:
+		return "🟡 Degraded"
+	}
+	return "🟢 OK"
+}
+
+func speedLevel(dlMbps, ulMbps, pingMs float64, c *config.Config) string {
 	downRate := dlMbps / c.CronSpeedTestJobExpDown
 	upRate := ulMbps / c.CronSpeedTestJobExpUp
 
 	if downRate < c.CronSpeedTestJobCritPct || upRate < c.CronSpeedTestJobCritPct || pingMs > c.CronSpeedTestJobCritLat {
-		return "🔴 Poor"
+		return common.StatusCritical
 	}
 	if downRate < c.CronSpeedTestJobWarnPct || upRate < c.CronSpeedTestJobWarnPct || pingMs > c.CronSpeedTestJobWarnLat {
-		return "🟡 Degraded"
+		return common.StatusWarning
 	}
-	return "🟢 OK"
+	return common.StatusOK
 }
 
-func runWithTimeout(ctx context.Context, logger zerolog.Logger, name string, fn func() error) error {
+// runWithTimeout runs fn in a span named name, giving up once ctx is done
+// even if fn doesn't return.
+func runWithTimeout(ctx context.Context, logger zerolog.Logger, name string, fn func(ctx context.Context) error) (err error) {
+	spanCtx, span := tracing.Start(ctx, name)
+	defer func() { tracing.End(span, err) }()
+
 	start := time.Now()
 	done := make(chan error, 1)
 	go func() {
 		logger.Debug().Str("operation", name).Msg("Operation started")
-		err := fn()
+		err := fn(spanCtx)
 		logger.Debug().Str("operation", name).Dur("duration", time.Since(start)).Err(err).Msg("Operation completed")
 		done <- err
 	}()
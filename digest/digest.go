@@ -0,0 +1,219 @@
+package digest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+
+	SectionDisk      = "disk"
+	SectionSpeedTest = "speedtest"
+	SectionAlerts    = "alerts"
+	SectionFailures  = "failures"
+)
+
+var DefaultSections = []string{SectionDisk, SectionSpeedTest, SectionAlerts, SectionFailures}
+
+func Period(kind string) time.Duration {
+	if kind == Weekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func Build(st *store.Store, kind string, sections []string, now time.Time) string {
+	if len(sections) == 0 {
+		sections = DefaultSections
+	}
+
+	since := now.Add(-Period(kind))
+
+	var b strings.Builder
+	if kind == Weekly {
+		fmt.Fprintf(&b, "🗞 Weekly digest (%s — %s)\n", since.Format("02 Jan"), now.Format("02 Jan"))
+	} else {
+		fmt.Fprintf(&b, "🗞 Daily digest (%s)\n", now.Format("02 Jan 2006"))
+	}
+
+	for _, section := range sections {
+		b.WriteString("\n")
+		switch strings.ToLower(strings.TrimSpace(section)) {
+		case SectionDisk:
+			writeDisks(&b, st.DiskSamplesSince(since), kind)
+		case SectionSpeedTest:
+			writeSpeedTests(&b, st.SpeedTestsSince(since), kind)
+		case SectionAlerts:
+			writeAlerts(&b, st.AlertsSince(since), kind)
+		case SectionFailures:
+			writeFailures(&b, st.JobFailuresSince(since), kind)
+		default:
+			fmt.Fprintf(&b, "⚠️ Unknown digest section %q\n", section)
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func writeDisks(b *strings.Builder, samples []store.DiskSample, kind string) {
+	b.WriteString("💾 Disks\n")
+	if len(samples) == 0 {
+		b.WriteString("No samples recorded\n")
+		return
+	}
+
+	byName := make(map[string][]store.DiskSample)
+	var names []string
+	for _, s := range samples {
+		if _, ok := byName[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		series := byName[name]
+		first, last := series[0], series[len(series)-1]
+		delta := (last.UsedBytes - first.UsedBytes) / gb
+
+		fmt.Fprintf(b, "• %s (%s): %d%%, %+.2f GB, %s\n", name, last.Path, last.Percentage, delta, forecast(series))
+
+		if kind == Weekly {
+			lo, hi := series[0].Percentage, series[0].Percentage
+			for _, s := range series {
+				lo = min(lo, s.Percentage)
+				hi = max(hi, s.Percentage)
+			}
+			fmt.Fprintf(b, "   range %d%%–%d%% over %d samples\n", lo, hi, len(series))
+		}
+	}
+}
+
+const gb = 1024 * 1024 * 1024
+
+// forecast fits a least-squares line through used bytes over time and
+// extrapolates when the volume runs out of space.
+func forecast(series []store.DiskSample) string {
+	if len(series) < 2 {
+		return "not enough data to forecast"
+	}
+
+	t0 := series[0].SampledAt
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, s := range series {
+		x := s.SampledAt.Sub(t0).Hours() / 24
+		y := s.UsedBytes
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return "not enough data to forecast"
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denom // bytes per day
+	if slope <= 0 {
+		return "not growing"
+	}
+
+	last := series[len(series)-1]
+	days := last.AvailBytes / slope
+	if math.IsInf(days, 0) || days > 3650 {
+		return "full in >10 years"
+	}
+
+	return fmt.Sprintf("%+.2f GB/day, full in ~%.0f days", slope/gb, days)
+}
+
+func writeSpeedTests(b *strings.Builder, samples []store.SpeedTestSample, kind string) {
+	b.WriteString("🚀 Speedtest\n")
+	if len(samples) == 0 {
+		b.WriteString("No speedtests recorded\n")
+		return
+	}
+
+	var down, up, ping float64
+	for _, s := range samples {
+		down += s.DownloadMbps
+		up += s.UploadMbps
+		ping += s.PingMs
+	}
+	n := float64(len(samples))
+	fmt.Fprintf(b, "Runs: %d\n", len(samples))
+	fmt.Fprintf(b, "Avg: ⬇️ %.2f ⬆️ %.2f MB/s, 🕒 %.1f ms\n", down/n, up/n, ping/n)
+
+	worst := make([]store.SpeedTestSample, len(samples))
+	copy(worst, samples)
+	sort.Slice(worst, func(i, j int) bool {
+		return worst[i].DownloadMbps < worst[j].DownloadMbps
+	})
+
+	limit := 1
+	if kind == Weekly {
+		limit = 3
+	}
+	for _, s := range worst[:min(limit, len(worst))] {
+		fmt.Fprintf(b, "Worst: ⬇️ %.2f ⬆️ %.2f MB/s, 🕒 %.1f ms at %s\n", s.DownloadMbps, s.UploadMbps, s.PingMs, s.SampledAt.Format("02 Jan 15:04"))
+	}
+}
+
+func writeAlerts(b *strings.Builder, events []store.AlertEvent, kind string) {
+	fired, resolved := 0, 0
+	for _, e := range events {
+		if e.Resolved {
+			resolved++
+		} else {
+			fired++
+		}
+	}
+	fmt.Fprintf(b, "🚨 Alerts: %d fired, %d resolved\n", fired, resolved)
+
+	limit := 5
+	if kind == Weekly {
+		limit = 15
+	}
+	for _, e := range events[max(0, len(events)-limit):] {
+		state := "fired " + e.Status
+		if e.Resolved {
+			state = "resolved"
+		}
+		fmt.Fprintf(b, "• %s %s — %s\n", e.At.Format("02 Jan 15:04"), state, e.Detail)
+	}
+}
+
+func writeFailures(b *strings.Builder, failures []store.JobFailure, kind string) {
+	fmt.Fprintf(b, "❌ Job failures: %d\n", len(failures))
+	if len(failures) == 0 {
+		return
+	}
+
+	if kind == Weekly {
+		counts := make(map[string]int)
+		var jobs []string
+		for _, f := range failures {
+			if counts[f.Job] == 0 {
+				jobs = append(jobs, f.Job)
+			}
+			counts[f.Job]++
+		}
+		sort.Strings(jobs)
+		for _, job := range jobs {
+			fmt.Fprintf(b, "• %s: %d\n", job, counts[job])
+		}
+	}
+
+	last := failures[len(failures)-1]
+	fmt.Fprintf(b, "Last: %s at %s — %s\n", last.Job, last.At.Format("02 Jan 15:04"), last.Error)
+}
@@ -0,0 +1,177 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	JobStarted      = "job.started"
+	JobFinished     = "job.finished"
+	DiskSample      = "disk.sample"
+	SpeedTestPhase  = "speedtest.phase"
+	SpeedTestResult = "speedtest.result"
+	Alert           = "alert"
+	Silence         = "silence"
+
+	bufferSize     = 500
+	subscriberSize = 64
+)
+
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Data any       `json:"data"`
+	At   time.Time `json:"at"`
+}
+
+// Bus fans events out to subscribers and keeps the most recent ones so a
+// reconnecting client can resume where it left off. A nil *Bus drops
+// everything, which keeps publishers free of nil checks.
+type Bus struct {
+	mu     sync.Mutex
+	lastID uint64
+	buffer []Event
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+func New() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish never blocks: a subscriber that cannot keep up is disconnected
+// and expected to resume with the last ID it saw.
+func (b *Bus) Publish(typ string, data any) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.lastID++
+	ev := Event{ID: b.lastID, Type: typ, Data: data, At: time.Now()}
+
+	b.buffer = append(b.buffer, ev)
+	if len(b.buffer) > bufferSize {
+		b.buffer = b.buffer[len(b.buffer)-bufferSize:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the buffered events after lastID and a channel of new
+// ones. The channel is closed when the subscriber falls behind, when cancel
+// is called or when the bus is closed.
+func (b *Bus) Subscribe(lastID uint64) ([]Event, <-chan Event, func()) {
+	ch := make(chan Event, subscriberSize)
+	if b == nil {
+		close(ch)
+		return nil, ch, func() {}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// IDs restart with the process, so an ID from the future means the
+	// client saw a previous run and gets everything still buffered.
+	if lastID > b.lastID {
+		lastID = 0
+	}
+
+	var backlog []Event
+	for _, ev := range b.buffer {
+		if ev.ID > lastID {
+			backlog = append(backlog, ev)
+		}
+	}
+
+	if b.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, cancel
+}
+
+// Close disconnects every subscriber so long-lived streams end on shutdown.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Follow calls fn with every event published from now on until stop is
+// closed or the bus is. A follower that falls behind resubscribes from the
+// last event it saw, so it only loses events that left the buffer meanwhile.
+func (b *Bus) Follow(stop <-chan struct{}, fn func(Event)) {
+	var lastID uint64
+	if b != nil {
+		b.mu.Lock()
+		lastID = b.lastID
+		b.mu.Unlock()
+	}
+
+	for {
+		backlog, ch, cancel := b.Subscribe(lastID)
+		received := len(backlog)
+		for _, e := range backlog {
+			fn(e)
+			lastID = e.ID
+		}
+
+	read:
+		for {
+			select {
+			case <-stop:
+				cancel()
+				return
+			case e, ok := <-ch:
+				if !ok {
+					break read
+				}
+				received++
+				fn(e)
+				lastID = e.ID
+			}
+		}
+		cancel()
+
+		// Nothing came through before the channel closed: the bus is gone
+		if received == 0 {
+			return
+		}
+	}
+}
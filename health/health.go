@@ -0,0 +1,202 @@
+package health
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+
+	// Long polls take up to 30s and network errors back off for up to 5m
+	pollStaleAfter = 10 * time.Minute
+	maxQueued      = 20
+)
+
+type Component struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status     string               `json:"status"`
+	CheckedAt  time.Time            `json:"checked_at"`
+	Components map[string]Component `json:"components"`
+}
+
+type jobDetail struct {
+	Status      string     `json:"status"`
+	LastSuccess *time.Time `json:"last_success"`
+	AgeSeconds  float64    `json:"age_seconds,omitempty"`
+}
+
+type Checker struct {
+	config    *config.Live
+	bot       *bot.Bot
+	cron      *cron.Cron
+	store     *store.Store
+	executor  *job.Executor
+	startedAt time.Time
+}
+
+func NewChecker(c *config.Live, b *bot.Bot, cr *cron.Cron, st *store.Store, ex *job.Executor) *Checker {
+	return &Checker{
+		config:    c,
+		bot:       b,
+		cron:      cr,
+		store:     st,
+		executor:  ex,
+		startedAt: time.Now(),
+	}
+}
+
+// Check inspects every component; the overall status is the worst of them.
+func (h *Checker) Check() Report {
+	now := time.Now()
+	r := Report{
+		Status:    StatusOK,
+		CheckedAt: now,
+		Components: map[string]Component{
+			"telegram":  h.telegram(now),
+			"scheduler": h.scheduler(),
+			"jobs":      h.jobs(now),
+			"paths":     h.paths(),
+			"outbox":    h.outbox(),
+		},
+	}
+
+	for _, c := range r.Components {
+		r.Status = worst(r.Status, c.Status)
+	}
+	return r
+}
+
+func (h *Checker) telegram(now time.Time) Component {
+	started, last, err := h.bot.PollStatus()
+	switch {
+	case started.IsZero():
+		return Component{Status: StatusFail, Message: "polling not started"}
+	case last.IsZero() && now.Sub(started) < pollStaleAfter:
+		return Component{Status: StatusOK, Message: "waiting for first poll"}
+	case last.IsZero():
+		return Component{Status: StatusFail, Message: fmt.Sprintf("no successful poll since start: %v", err)}
+	case now.Sub(last) > pollStaleAfter:
+		return Component{Status: StatusFail, Message: fmt.Sprintf("last successful poll %s ago: %v", now.Sub(last).Round(time.Second), err), Details: map[string]time.Time{"last_success": last}}
+	case err != nil:
+		return Component{Status: StatusDegraded, Message: err.Error(), Details: map[string]time.Time{"last_success": last}}
+	}
+	return Component{Status: StatusOK, Details: map[string]time.Time{"last_success": last}}
+}
+
+func (h *Checker) scheduler() Component {
+	if h.executor.Closed() {
+		return Component{Status: StatusFail, Message: "shutting down"}
+	}
+	if !h.cron.Running() {
+		return Component{Status: StatusFail, Message: "scheduler not running"}
+	}
+	return Component{Status: StatusOK}
+}
+
+// jobs flags scheduled jobs that have missed two consecutive runs without
+// succeeding.
+func (h *Checker) jobs(now time.Time) Component {
+	cfg := h.config.Get()
+	c := Component{Status: StatusOK}
+	details := make(map[string]jobDetail)
+	var stale []string
+
+	for _, def := range job.Definitions() {
+		if def.Schedule == nil || !def.Enabled(cfg) {
+			continue
+		}
+		schedule, err := common.ParseSchedule(def.Schedule(cfg))
+		if err != nil {
+			continue
+		}
+
+		d := jobDetail{Status: StatusOK}
+		// Time spent down before this start doesn't count against a job
+		since := h.startedAt
+		if run, ok := h.store.LastSuccessfulRun(def.Name); ok {
+			finished := run.StartedAt.Add(run.Duration)
+			d.LastSuccess = &finished
+			d.AgeSeconds = now.Sub(finished).Seconds()
+			if finished.After(since) {
+				since = finished
+			}
+		}
+		if now.After(schedule.Next(schedule.Next(since))) {
+			d.Status = StatusDegraded
+			stale = append(stale, def.Name)
+		}
+		details[def.Name] = d
+	}
+
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		c.Status = StatusDegraded
+		c.Message = fmt.Sprintf("no recent success for %v", stale)
+	}
+	c.Details = details
+	return c
+}
+
+func (h *Checker) paths() Component {
+	cfg := h.config.Get()
+	seen := make(map[string]bool)
+	details := make(map[string]string)
+	c := Component{Status: StatusOK}
+
+	for _, def := range job.Definitions() {
+		if def.Path == nil || def.Enabled == nil || !def.Enabled(cfg) {
+			continue
+		}
+		path := def.Path(cfg)
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if _, err := os.Stat(path); err != nil {
+			details[path] = err.Error()
+			c.Status = StatusFail
+			c.Message = "monitored path not accessible"
+			continue
+		}
+		details[path] = StatusOK
+	}
+
+	c.Details = details
+	return c
+}
+
+func (h *Checker) outbox() Component {
+	depth := h.bot.Queued()
+	c := Component{Status: StatusOK, Details: map[string]int64{"depth": depth}}
+	if depth > maxQueued {
+		c.Status = StatusDegraded
+		c.Message = "Telegram messages piling up"
+	}
+	return c
+}
+
+func worst(a, b string) string {
+	rank := map[string]int{StatusOK: 0, StatusDegraded: 1, StatusFail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,292 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxPending bounds the points kept while InfluxDB is unreachable; the
+	// oldest are dropped beyond it.
+	maxPending = 10000
+	// maxDatagram keeps UDP packets under a typical MTU
+	maxDatagram = 1400
+)
+
+// Exporter writes every disk sample and speedtest result to InfluxDB. It
+// reads the influxdb block on every flush, so reloads apply from the next
+// one, and points recorded while it is disabled are dropped.
+type Exporter struct {
+	logger  *zerolog.Logger
+	config  *config.Live
+	events  *events.Bus
+	client  *http.Client
+	mu      sync.Mutex
+	pending []string
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewExporter(l *zerolog.Logger, c *config.Live, ev *events.Bus) *Exporter {
+	logger := l.With().Str("type", "influx").Logger()
+
+	return &Exporter{
+		logger: &logger,
+		config: c,
+		events: ev,
+		client: &http.Client{},
+		flush:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (e *Exporter) Start() {
+	if c := e.config.Get().Influxdb; c.Url != "" {
+		e.logger.Info().Str("url", c.Url).Int("version", c.Version).Msg("Writing samples to InfluxDB")
+	}
+
+	go e.events.Follow(e.stop, e.record)
+	go e.loop()
+}
+
+// Stop ends the flush loop and writes whatever is still pending.
+func (e *Exporter) Stop(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if c := e.config.Get().Influxdb; c.Url != "" {
+		e.write(ctx, c)
+	}
+	return ctx.Err()
+}
+
+func (e *Exporter) record(ev events.Event) {
+	c := e.config.Get().Influxdb
+	if c.Url == "" {
+		return
+	}
+
+	var l string
+	switch data := ev.Data.(type) {
+	case store.DiskSample:
+		l = diskLine(c.DiskMeasurement, staticTags(c), data)
+	case store.SpeedTestSample:
+		l = speedTestLine(c.SpeedTestMeasurement, staticTags(c), data)
+	default:
+		return
+	}
+	if l == "" {
+		e.logger.Warn().Str("event", ev.Type).Msg("Sample has no finite fields, not writing it")
+		return
+	}
+
+	e.mu.Lock()
+	e.pending = append(e.pending, l)
+	full := len(e.pending) >= c.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// staticTags returns the configured tags, host defaulting to the hostname.
+func staticTags(c config.InfluxdbConfig) map[string]string {
+	tags := maps.Clone(c.Tags)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	if tags["host"] == "" {
+		tags["host"], _ = os.Hostname()
+	}
+	return tags
+}
+
+func (e *Exporter) loop() {
+	defer close(e.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		interval := time.Minute
+		if c := e.config.Get().Influxdb; c.Url != "" {
+			interval = c.FlushInterval
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-e.flush:
+			timer.Stop()
+		}
+
+		if c := e.config.Get().Influxdb; c.Url != "" {
+			e.write(ctx, c)
+		}
+	}
+}
+
+// write sends the pending points in batches of batch_size. A batch that
+// still fails after the retries stays queued for the next flush, unless
+// InfluxDB rejected it outright.
+func (e *Exporter) write(ctx context.Context, c config.InfluxdbConfig) {
+	for {
+		e.mu.Lock()
+		n := min(len(e.pending), c.BatchSize)
+		batch := e.pending[:n:n]
+		e.mu.Unlock()
+		if n == 0 {
+			return
+		}
+
+		attempts, err := common.Retry(ctx, c.Retries, func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+			return e.send(ctx, c, batch)
+		})
+
+		e.mu.Lock()
+		if err == nil || common.IsPermanent(err) {
+			e.pending = e.pending[n:]
+		} else if dropped := len(e.pending) - maxPending; dropped > 0 {
+			e.pending = e.pending[dropped:]
+			e.logger.Warn().Int("dropped", dropped).Msg("Too many points pending, dropping the oldest")
+		}
+		e.mu.Unlock()
+
+		if common.IsPermanent(err) {
+			e.logger.Error().Err(err).Int("points", n).Msg("InfluxDB rejected points, dropping them")
+			continue
+		}
+		if err != nil {
+			e.logger.Warn().Err(err).Int("points", n).Int("attempts", attempts).Msg("Failed to write to InfluxDB, keeping points for the next flush")
+			return
+		}
+		e.logger.Debug().Int("points", n).Int("attempts", attempts).Msg("Points written")
+	}
+}
+
+func (e *Exporter) send(ctx context.Context, c config.InfluxdbConfig, lines []string) error {
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return common.Permanent(err)
+	}
+	if u.Scheme == "udp" {
+		return sendUDP(ctx, u.Host, lines)
+	}
+	return e.sendHTTP(ctx, c, u, lines)
+}
+
+func (e *Exporter) sendHTTP(ctx context.Context, c config.InfluxdbConfig, u *url.URL, lines []string) error {
+	q := url.Values{}
+	if c.Version == 1 {
+		u = u.JoinPath("write")
+		q.Set("db", c.Database)
+		if c.RetentionPolicy != "" {
+			q.Set("rp", c.RetentionPolicy)
+		}
+	} else {
+		u = u.JoinPath("api", "v2", "write")
+		q.Set("org", c.Org)
+		q.Set("bucket", c.Bucket)
+	}
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(body))
+	if err != nil {
+		return common.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Token "+c.Token)
+	case c.Username != "" || c.Password != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("write to %s: %s: %s", u.Redacted(), resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return common.Permanent(err)
+	}
+	return err
+}
+
+// sendUDP writes lines to an InfluxDB UDP listener, packing as many as fit
+// in each datagram. Delivery isn't confirmed, only send errors show.
+func sendUDP(ctx context.Context, addr string, lines []string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+
+	for _, l := range lines {
+		if packet.Len() > 0 && packet.Len()+len(l)+1 > maxDatagram {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		packet.WriteString(l)
+		packet.WriteByte('\n')
+	}
+	return send()
+}
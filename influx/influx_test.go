@@ -0,0 +1,193 @@
+package influx
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+// received is a write captured by the stand-in InfluxDB.
+type received struct {
+	path  string
+	query map[string]string
+	auth  string
+	lines []string
+}
+
+// receiver stands in for InfluxDB, answering with the given statuses in turn
+// and the last one from then on.
+type receiver struct {
+	mu       sync.Mutex
+	requests []received
+	statuses []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		query := map[string]string{}
+		for k := range req.URL.Query() {
+			query[k] = req.URL.Query().Get(k)
+		}
+
+		r.mu.Lock()
+		r.requests = append(r.requests, received{
+			path:  req.URL.Path,
+			query: query,
+			auth:  req.Header.Get("Authorization"),
+			lines: strings.Split(strings.TrimSuffix(string(body), "\n"), "\n"),
+		})
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status = r.statuses[min(len(r.requests), len(r.statuses))-1]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv.URL
+}
+
+func (r *receiver) received() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.requests...)
+}
+
+func testConfig(url string) config.InfluxdbConfig {
+	return config.InfluxdbConfig{
+		Url:                  url,
+		Version:              2,
+		Org:                  "home",
+		Bucket:               "servers",
+		Token:                "secret",
+		BatchSize:            2,
+		FlushInterval:        time.Minute,
+		Timeout:              5 * time.Second,
+		DiskMeasurement:      "disk",
+		SpeedTestMeasurement: "speedtest",
+		Tags:                 map[string]string{"host": "box"},
+	}
+}
+
+func newTestExporter(c config.InfluxdbConfig) *Exporter {
+	l := zerolog.Nop()
+	return NewExporter(&l, config.NewLive(&config.Config{Influxdb: c}), events.New())
+}
+
+func recordSamples(e *Exporter) {
+	for _, name := range []string{"server", "plex", "backup"} {
+		e.record(events.Event{Type: "disk", Data: store.DiskSample{Name: name, Path: "/" + name, Percentage: 10, SampledAt: at}})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	r, url := newReceiver(t)
+	c := testConfig(url)
+	e := newTestExporter(c)
+
+	recordSamples(e)
+	e.record(events.Event{Type: "speedtest", Data: store.SpeedTestSample{DownloadMbps: math.NaN(), UploadMbps: 20, Status: "ok", SampledAt: at}})
+	e.write(context.Background(), c)
+
+	got := r.received()
+	if len(got) != 2 {
+		t.Fatalf("got %d writes, want 2", len(got))
+	}
+	for _, req := range got {
+		if req.path != "/api/v2/write" || req.query["org"] != "home" || req.query["bucket"] != "servers" || req.query["precision"] != "ns" {
+			t.Errorf("write to %s %v", req.path, req.query)
+		}
+		if req.auth != "Token secret" {
+			t.Errorf("Authorization = %q", req.auth)
+		}
+		if len(req.lines) != 2 {
+			t.Errorf("batch of %d lines, want 2: %q", len(req.lines), req.lines)
+		}
+	}
+	if l := got[0].lines[0]; !strings.HasPrefix(l, "disk,host=box,name=server,path=/server percentage=10i,") {
+		t.Errorf("first line = %q", l)
+	}
+	if l := got[1].lines[1]; l != `speedtest,host=box upload_mbps=20,ping_ms=0,status="ok" 1700000000000000123` {
+		t.Errorf("speedtest line = %q", l)
+	}
+	if len(e.pending) != 0 {
+		t.Errorf("%d points still pending", len(e.pending))
+	}
+}
+
+func TestVersion1(t *testing.T) {
+	r, url := newReceiver(t)
+	c := testConfig(url)
+	c.Version = 1
+	c.Database = "servers"
+	c.RetentionPolicy = "week"
+	c.Token = ""
+	c.Username = "writer"
+	c.Password = "pass"
+	e := newTestExporter(c)
+
+	recordSamples(e)
+	e.write(context.Background(), c)
+
+	got := r.received()
+	if len(got) != 2 {
+		t.Fatalf("got %d writes, want 2", len(got))
+	}
+	if req := got[0]; req.path != "/write" || req.query["db"] != "servers" || req.query["rp"] != "week" {
+		t.Errorf("write to %s %v", req.path, req.query)
+	}
+	if auth := got[0].auth; !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("Authorization = %q, want basic auth", auth)
+	}
+}
+
+func TestFailedWrites(t *testing.T) {
+	t.Run("rejected batch is dropped", func(t *testing.T) {
+		r, url := newReceiver(t, http.StatusBadRequest, http.StatusNoContent)
+		c := testConfig(url)
+		c.Retries = 3
+		e := newTestExporter(c)
+
+		recordSamples(e)
+		e.write(context.Background(), c)
+
+		if got := len(r.received()); got != 2 {
+			t.Errorf("got %d writes, want 2 without retrying the rejected batch", got)
+		}
+		if len(e.pending) != 0 {
+			t.Errorf("%d points still pending", len(e.pending))
+		}
+	})
+
+	t.Run("unreachable keeps points", func(t *testing.T) {
+		r, url := newReceiver(t, http.StatusServiceUnavailable)
+		c := testConfig(url)
+		e := newTestExporter(c)
+
+		recordSamples(e)
+		e.write(context.Background(), c)
+
+		if got := len(r.received()); got != 1 {
+			t.Errorf("got %d writes, want 1", got)
+		}
+		if len(e.pending) != 3 {
+			t.Errorf("%d points pending, want 3", len(e.pending))
+		}
+	})
+}
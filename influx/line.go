@@ -0,0 +1,113 @@
+package influx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// field is a line protocol field value: float64, int64 or string.
+type field struct {
+	key   string
+	value any
+}
+
+// line formats one point of line protocol with a nanosecond timestamp.
+// Empty tag values and NaN or infinite fields are left out, as InfluxDB
+// rejects the whole write over them. It returns "" if no field is left.
+func line(measurement string, tags map[string]string, fields []field, at time.Time) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	// Sorted tags are what InfluxDB stores and parses fastest
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(tags[k]))
+	}
+
+	written := 0
+	for _, f := range fields {
+		if v, ok := f.value.(float64); ok && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			continue
+		}
+		if written == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		written++
+		b.WriteString(keyEscaper.Replace(f.key))
+		b.WriteByte('=')
+		switch v := f.value.(type) {
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case int64:
+			b.WriteString(strconv.FormatInt(v, 10))
+			b.WriteByte('i')
+		case string:
+			b.WriteByte('"')
+			b.WriteString(stringEscaper.Replace(v))
+			b.WriteByte('"')
+		}
+	}
+
+	if written == 0 {
+		return ""
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(at.UnixNano(), 10))
+	return b.String()
+}
+
+// withTags returns the static tags extended by the point's own.
+func withTags(static map[string]string, kv ...string) map[string]string {
+	tags := make(map[string]string, len(static)+len(kv)/2)
+	for k, v := range static {
+		tags[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		tags[kv[i]] = kv[i+1]
+	}
+	return tags
+}
+
+func diskLine(measurement string, static map[string]string, s store.DiskSample) string {
+	return line(measurement, withTags(static, "name", s.Name, "path", s.Path), []field{
+		{"percentage", int64(s.Percentage)},
+		{"used_bytes", s.UsedBytes},
+		{"avail_bytes", s.AvailBytes},
+		{"inodes_total", int64(s.InodesTotal)},
+		{"inodes_used", int64(s.InodesUsed)},
+		{"inodes_percent", int64(s.InodesPercent)},
+		{"status", s.Status},
+	}, s.SampledAt)
+}
+
+func speedTestLine(measurement string, static map[string]string, s store.SpeedTestSample) string {
+	return line(measurement, withTags(static, "server", s.Server, "isp", s.ISP), []field{
+		{"download_mbps", s.DownloadMbps},
+		{"upload_mbps", s.UploadMbps},
+		{"ping_ms", s.PingMs},
+		{"status", s.Status},
+	}, s.SampledAt)
+}
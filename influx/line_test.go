@@ -0,0 +1,84 @@
+package influx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+var at = time.Unix(1700000000, 123)
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      []field
+		want        string
+	}{
+		{
+			name:        "types",
+			measurement: "disk",
+			tags:        map[string]string{"name": "server"},
+			fields:      []field{{"percentage", int64(42)}, {"avail_bytes", 2.5e9}, {"status", "ok"}},
+			want:        `disk,name=server percentage=42i,avail_bytes=2500000000,status="ok" 1700000000000000123`,
+		},
+		{
+			name:        "escaping",
+			measurement: "disk usage,all",
+			tags:        map[string]string{"path": `/mnt/my disk,a=b`, "host k": "box\nnext"},
+			fields:      []field{{"note=x", `say "hi" \ bye` + "\n"}},
+			want:        `disk\ usage\,all,host\ k=box\nnext,path=/mnt/my\ disk\,a\=b note\=x="say \"hi\" \\ bye\n" 1700000000000000123`,
+		},
+		{
+			name:        "sorted tags without empty values",
+			measurement: "speedtest",
+			tags:        map[string]string{"server": "Kyiv", "isp": "", "host": "box"},
+			fields:      []field{{"ping_ms", 5.25}},
+			want:        `speedtest,host=box,server=Kyiv ping_ms=5.25 1700000000000000123`,
+		},
+		{
+			name:        "non-finite fields left out",
+			measurement: "speedtest",
+			fields:      []field{{"download_mbps", math.NaN()}, {"upload_mbps", math.Inf(1)}, {"ping_ms", math.Inf(-1)}, {"status", "error"}},
+			want:        `speedtest status="error" 1700000000000000123`,
+		},
+		{
+			name:        "no fields left",
+			measurement: "speedtest",
+			fields:      []field{{"download_mbps", math.NaN()}},
+			want:        "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := line(tt.measurement, tt.tags, tt.fields, at); got != tt.want {
+				t.Errorf("line() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleLines(t *testing.T) {
+	static := map[string]string{"host": "box"}
+
+	got := diskLine("disk", static, store.DiskSample{
+		Name: "plex", Path: "/media", Percentage: 42, UsedBytes: 3e9, AvailBytes: 1e9,
+		InodesTotal: 100, InodesUsed: 10, InodesPercent: 10, Status: "ok", SampledAt: at,
+	})
+	want := `disk,host=box,name=plex,path=/media percentage=42i,used_bytes=3000000000,avail_bytes=1000000000,inodes_total=100i,inodes_used=10i,inodes_percent=10i,status="ok" 1700000000000000123`
+	if got != want {
+		t.Errorf("diskLine() =\n%s\nwant\n%s", got, want)
+	}
+
+	got = speedTestLine("speedtest", static, store.SpeedTestSample{
+		Server: "Kyiv", DownloadMbps: 100.5, UploadMbps: math.NaN(), PingMs: 5, Status: "ok", SampledAt: at,
+	})
+	want = `speedtest,host=box,server=Kyiv download_mbps=100.5,ping_ms=5,status="ok" 1700000000000000123`
+	if got != want {
+		t.Errorf("speedTestLine() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -49,7 +49,7 @@ func New(level string) (zerolog.Logger, error) {
 		Compress:   true,
 	}
 
-	multiWriter := io.MultiWriter(os.Stdout, fileWriter)
+	multiWriter := redactor{io.MultiWriter(os.Stdout, fileWriter)}
 
 	logger := zerolog.New(multiWriter).
 		With().
@@ -60,3 +60,24 @@ func New(level string) (zerolog.Logger, error) {
 
 	return logger, nil
 }
+
+// NewConsole returns a logger writing to stderr only, for CLI commands whose
+// stdout carries their result.
+func NewConsole(level string) (zerolog.Logger, error) {
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+
+	logLevel, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return zerolog.Logger{}, err
+	}
+
+	zerolog.SetGlobalLevel(logLevel)
+
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: redactor{os.Stderr}}).
+		With().
+		Timestamp().
+		Logger()
+
+	return logger, nil
+}
@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLength keeps short values, which would match all over the log,
+// from being redacted.
+const minSecretLength = 6
+
+var secrets atomic.Pointer[[][]byte]
+
+// SetSecrets replaces the values masked in every log line written from now
+// on, both as is and JSON escaped.
+func SetSecrets(values []string) {
+	var masks [][]byte
+	for _, v := range values {
+		if len(v) < minSecretLength {
+			continue
+		}
+		masks = append(masks, []byte(v))
+		if escaped, err := json.Marshal(v); err == nil && string(escaped[1:len(escaped)-1]) != v {
+			masks = append(masks, escaped[1:len(escaped)-1])
+		}
+	}
+	secrets.Store(&masks)
+}
+
+type redactor struct {
+	w io.Writer
+}
+
+func (r redactor) Write(p []byte) (int, error) {
+	masks := secrets.Load()
+	if masks == nil {
+		return r.w.Write(p)
+	}
+
+	out := p
+	for _, m := range *masks {
+		if bytes.Contains(out, m) {
+			out = bytes.ReplaceAll(out, m, []byte(redacted))
+		}
+	}
+	if _, err := r.w.Write(out); err != nil {
+		return 0, err
+	}
+	// Report the original length, callers treat anything else as a short write
+	return len(p), nil
+}
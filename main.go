@@ -1,90 +1,134 @@
 package main
 
 import (
-	"context"
-	"log"
-	"os/signal"
-	"syscall"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/koss-shtukert/servers-stats/api"
-	"github.com/koss-shtukert/servers-stats/cron"
-
-	"github.com/koss-shtukert/servers-stats/bot"
 	"github.com/koss-shtukert/servers-stats/config"
-	"github.com/koss-shtukert/servers-stats/logger"
 )
 
+const usage = `Usage: servers-stats <command> [flags]
+
+Commands:
+  run                      start the daemon (default when no command is given)
+  run --once               run every enabled job once and exit with a Nagios exit code
+  validate                 check the config and report every problem
+  config show              print the effective config and where each value came from
+  check disk <path>...     show disk usage for the given paths
+  check speedtest          run a speed test
+
+Common flags:
+  --config <path>          config file or directory holding config.yaml (default ".")
+  --log-level <level>      override log_level
+  --format table|json      output format of check, config show and run --once
+
+Run "servers-stats <command> -h" for the flags of a command.
+`
+
 func main() {
-	cfg, err := config.Load(".")
-	if err != nil {
-		log.Fatal("Config error: ", err)
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		os.Exit(run(args))
 	}
 
-	logr, err := logger.New(cfg.LogLevel)
-	if err != nil {
-		log.Fatal("Logger error: ", err)
+	switch args[0] {
+	case "run":
+		os.Exit(run(args[1:]))
+	case "validate":
+		os.Exit(validate(args[1:]))
+	case "check":
+		os.Exit(check(args[1:]))
+	case "config":
+		os.Exit(configCommand(args[1:]))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
 	}
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+func commonFlags(fs *flag.FlagSet) (configPath, logLevel *string) {
+	configPath = fs.String("config", ".", "config file, or directory holding config.yaml")
+	logLevel = fs.String("log-level", "", "override log_level")
+	return configPath, logLevel
+}
 
-	tgBot, err := bot.CreateBot(cfg, &logr)
-	if err != nil {
-		log.Fatal("Telegram bot error: ", err)
+// parseArgs parses fs from args, allowing flags after positional arguments
+// as in "check disk / --format json", and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+}
 
-	cronJob := cron.NewCron(&logr, cfg, tgBot)
+// validate loads the config and prints every problem found, exiting 1 if
+// there are any.
+func validate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath, _ := commonFlags(fs)
+	fs.Parse(args)
 
-	if cfg.CronRunMotioneyeDiskUsageJob {
-		cronJob.AddMotioneyeDiskUsageJob()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
 
-	if cfg.CronRunPlexDiskUsageJob {
-		cronJob.AddPlexDiskUsageJob()
+	for _, w := range cfg.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", w)
 	}
 
-	if cfg.CronRunServerDiskUsageJob {
-		cronJob.AddServerDiskUsageJob()
+	file := cfg.File()
+	if file == "" {
+		file = "environment only, no config file found"
 	}
+	fmt.Printf("Config OK (%s)\n", file)
+	return 0
+}
 
-	if cfg.CronRunSpeedTestJob {
-		cronJob.AddSpeedTestJob()
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "Usage: servers-stats config show [--config path] [--format table|json]\n")
+		return 2
 	}
 
-	if cfg.CronRunMotioneyeMetricsJob {
-		cronJob.AddMotioneyeMetricsJob()
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	configPath, logLevel := commonFlags(fs)
+	format := fs.String("format", formatTable, "output format: table or json")
+	fs.Parse(args[1:])
+	if !validFormat(*format) {
+		return 2
 	}
 
-	if cfg.CronRunServerMetricsJob {
-		cronJob.AddServerMetricsJob()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
-
-	if cfg.CronRunPlexMetricsJob {
-		cronJob.AddPlexMetricsJob()
+	if *logLevel != "" {
+		cfg.OverrideLogLevel(*logLevel)
 	}
 
-	s := api.CreateServer(&logr, cfg, tgBot)
-
-	cronJob.Start()
-	logr.Info().Str("type", "core").Msg("Cron started")
-
-	tgBot.StartPolling(ctx, &logr, cfg)
-	logr.Info().Str("type", "core").Msg("Telegram polling started")
-
-	go func() {
-		if err := s.Start(); err != nil {
-			logr.Fatal().Err(err).Msg("Failed to start server")
-		}
-	}()
-	logr.Info().Str("type", "core").Msg("Server started")
-
-	<-ctx.Done()
-	logr.Info().Str("type", "core").Msg("Shutdown signal received")
-
-	// Graceful shutdown
-	if err := s.Shutdown(); err != nil {
-		logr.Error().Err(err).Msg("Error during server shutdown")
+	if *format == formatJSON {
+		printJSON(map[string]any{"file": cfg.File(), "settings": cfg.Settings()})
+		return 0
 	}
 
-	logr.Info().Str("type", "core").Msg("Application shutdown complete")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSOURCE\tORIGIN\tVALUE")
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Key, s.Source, s.Origin, s.ValueString())
+	}
+	w.Flush()
+	return 0
 }
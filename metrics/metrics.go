@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -23,6 +25,37 @@ var (
 			Name: "disk_usage_avail_bytes",
 			Help: "Disk available space in bytes",
 		}, []string{"path", "type"})
+
+	JobSkippedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_skipped_total",
+			Help: "Job runs skipped because a previous run was still in progress",
+		}, []string{"job"})
+
+	JobTimeoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_timeouts_total",
+			Help: "Job runs cancelled after exceeding their timeout",
+		}, []string{"job"})
+
+	JobRunsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_runs_total",
+			Help: "Job runs by outcome",
+		}, []string{"job", "result"})
+
+	JobDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "job_duration_seconds",
+			Help:    "Job run duration in seconds",
+			Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+		}, []string{"job"})
+
+	JobLastSuccessTimestamp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "job_last_success_timestamp",
+			Help: "Unix timestamp of the last successful job run",
+		}, []string{"job"})
 )
 
 func RecordDiskUsageDetailed(path, diskType string, percent int, usedBytes, availBytes float64) {
@@ -30,3 +63,11 @@ func RecordDiskUsageDetailed(path, diskType string, percent int, usedBytes, avai
 	DiskUsageUsedBytes.WithLabelValues(path, diskType).Set(usedBytes)
 	DiskUsageAvailBytes.WithLabelValues(path, diskType).Set(availBytes)
 }
+
+func RecordJobRun(job, result string, duration time.Duration, finishedAt time.Time) {
+	JobRunsTotal.WithLabelValues(job, result).Inc()
+	JobDurationSeconds.WithLabelValues(job).Observe(duration.Seconds())
+	if result == "success" {
+		JobLastSuccessTimestamp.WithLabelValues(job).Set(float64(finishedAt.Unix()))
+	}
+}
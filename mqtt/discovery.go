@@ -0,0 +1,139 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koss-shtukert/servers-stats/cron/job"
+)
+
+// discovery is a Home Assistant MQTT discovery config, see
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+type discovery struct {
+	Name              string `json:"name"`
+	UniqueId          string `json:"unique_id"`
+	ObjectId          string `json:"object_id"`
+	StateTopic        string `json:"state_topic,omitempty"`
+	CommandTopic      string `json:"command_topic,omitempty"`
+	PayloadPress      string `json:"payload_press,omitempty"`
+	ValueTemplate     string `json:"value_template,omitempty"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string `json:"device_class,omitempty"`
+	StateClass        string `json:"state_class,omitempty"`
+	Icon              string `json:"icon,omitempty"`
+	AvailabilityTopic string `json:"availability_topic"`
+	Device            device `json:"device"`
+}
+
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// sensor is one value of a state topic exposed as a Home Assistant sensor.
+type sensor struct {
+	id, name, field, unit, deviceClass, icon string
+}
+
+var (
+	diskSensors = []sensor{
+		{"usage", "disk usage", "percentage", "%", "", "mdi:harddisk"},
+		{"available", "disk available", "avail_bytes", "B", "data_size", ""},
+		{"used", "disk used", "used_bytes", "B", "data_size", ""},
+		{"inodes", "inode usage", "inodes_percent", "%", "", "mdi:file-multiple"},
+		{"status", "disk status", "status", "", "", "mdi:harddisk"},
+	}
+
+	speedTestSensors = []sensor{
+		{"download", "download", "download_mbps", "Mbit/s", "data_rate", ""},
+		{"upload", "upload", "upload_mbps", "Mbit/s", "data_rate", ""},
+		{"ping", "ping", "ping_ms", "ms", "duration", ""},
+		{"status", "speedtest status", "status", "", "", "mdi:speedometer"},
+	}
+)
+
+// announce publishes the discovery configs known up front: the speedtest
+// sensors, a button per job that can be triggered and the sensors of every
+// disk sampled so far. Disks sampled later are announced on their first
+// sample.
+func (p *Publisher) announce() {
+	if p.config.DiscoveryPrefix == "" {
+		return
+	}
+
+	for _, s := range speedTestSensors {
+		p.publishSensor("speedtest_"+s.id, s.name, p.speedTestTopic(), s)
+	}
+
+	cfg := p.live.Get()
+	for _, def := range job.Definitions() {
+		if !commandable(def, cfg) {
+			continue
+		}
+		p.publishDiscovery("button", def.Name, discovery{
+			Name:         def.Title,
+			CommandTopic: p.commandTopic(def.Name),
+			PayloadPress: "PRESS",
+			Icon:         "mdi:play",
+		})
+	}
+
+	for _, sample := range p.store.LatestDiskSamples() {
+		p.announceDisk(sample.Name)
+	}
+}
+
+// announceDisk publishes the sensors of disk name unless already done since
+// the last connect.
+func (p *Publisher) announceDisk(name string) {
+	if p.config.DiscoveryPrefix == "" {
+		return
+	}
+
+	p.mu.Lock()
+	seen := p.discovered[name]
+	p.discovered[name] = true
+	p.mu.Unlock()
+	if seen {
+		return
+	}
+
+	title := strings.ToUpper(name[:1]) + name[1:]
+	for _, s := range diskSensors {
+		p.publishSensor(fmt.Sprintf("disk_%s_%s", name, s.id), title+" "+s.name, p.diskTopic(name), s)
+	}
+}
+
+func (p *Publisher) publishSensor(objectId, name, stateTopic string, s sensor) {
+	d := discovery{
+		Name:              name,
+		StateTopic:        stateTopic,
+		ValueTemplate:     "{{ value_json." + s.field + " }}",
+		UnitOfMeasurement: s.unit,
+		DeviceClass:       s.deviceClass,
+		Icon:              s.icon,
+	}
+	if s.unit != "" {
+		d.StateClass = "measurement"
+	}
+	p.publishDiscovery("sensor", objectId, d)
+}
+
+// publishDiscovery fills in the fields shared by every entity and publishes
+// d retained, as Home Assistant expects.
+func (p *Publisher) publishDiscovery(component, objectId string, d discovery) {
+	d.UniqueId = "servers_stats_" + p.node + "_" + objectId
+	d.ObjectId = p.node + "_" + objectId
+	d.AvailabilityTopic = p.availabilityTopic()
+	d.Device = device{
+		Identifiers:  []string{"servers_stats_" + p.node},
+		Name:         "servers-stats " + p.node,
+		Manufacturer: "servers-stats",
+		Model:        "servers-stats",
+	}
+
+	topic := fmt.Sprintf("%s/%s/%s/%s/config", p.config.DiscoveryPrefix, component, p.node, objectId)
+	p.publish(topic, true, d)
+}
@@ -0,0 +1,305 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/rs/zerolog"
+)
+
+const (
+	online         = "online"
+	offline        = "offline"
+	publishTimeout = 10 * time.Second
+	// quiesce gives in-flight messages time to go out on disconnect, in ms.
+	quiesce = 250
+)
+
+var invalidNodeChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// JobRunner starts jobs with the rate limit and overlap rules of the other
+// triggers and delivers their notifications, as *bot.Bot does.
+type JobRunner interface {
+	common.Notifier
+	CanExecuteCommand(def job.Definition) bool
+	ExecuteJob(def job.Definition, d job.Deps) job.RunResult
+}
+
+// Publisher mirrors disk samples and speedtest results to an MQTT broker,
+// announces them to Home Assistant and runs jobs published to its command
+// topics. A nil *Publisher does nothing, which is what NewPublisher returns
+// with no broker configured.
+type Publisher struct {
+	logger     *zerolog.Logger
+	config     config.MqttConfig
+	live       *config.Live
+	runner     JobRunner
+	store      *store.Store
+	executor   *job.Executor
+	events     *events.Bus
+	client     paho.Client
+	base       string
+	node       string
+	mu         sync.Mutex
+	discovered map[string]bool
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func NewPublisher(l *zerolog.Logger, cfg *config.Live, r JobRunner, st *store.Store, ex *job.Executor, ev *events.Bus) *Publisher {
+	c := cfg.Get().Mqtt
+	if c.Broker == "" {
+		return nil
+	}
+	logger := l.With().Str("type", "mqtt").Logger()
+
+	node := c.NodeId
+	if node == "" {
+		hostname, _ := os.Hostname()
+		node = strings.Trim(invalidNodeChars.ReplaceAllString(strings.ToLower(hostname), "_"), "_")
+		if node == "" {
+			node = "servers_stats"
+		}
+	}
+
+	p := &Publisher{
+		logger:     &logger,
+		config:     c,
+		live:       cfg,
+		runner:     r,
+		store:      st,
+		executor:   ex,
+		events:     ev,
+		base:       c.TopicPrefix + "/" + node,
+		node:       node,
+		discovered: make(map[string]bool),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	clientId := c.ClientId
+	if clientId == "" {
+		clientId = "servers-stats-" + node
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(clientId).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		// Handlers publish and wait, which would deadlock an ordered client
+		SetOrderMatters(false).
+		SetWill(p.availabilityTopic(), offline, 1, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warn().Err(err).Msg("Connection to broker lost, reconnecting")
+		})
+	p.client = paho.NewClient(opts)
+
+	return p
+}
+
+// Start connects in the background, retrying until the broker is reachable,
+// and starts forwarding events.
+func (p *Publisher) Start() {
+	if p == nil {
+		return
+	}
+
+	p.client.Connect()
+	p.logger.Info().Str("broker", p.config.Broker).Str("topic", p.base).Msg("Connecting to MQTT broker")
+
+	go p.forward()
+}
+
+// Stop marks the node offline and disconnects, waiting at most until ctx
+// is done for the last messages to go out.
+func (p *Publisher) Stop(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	close(p.stop)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if p.client.IsConnectionOpen() {
+		token := p.client.Publish(p.availabilityTopic(), 1, true, offline)
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+		}
+	}
+	p.client.Disconnect(quiesce)
+	return ctx.Err()
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.base + "/availability"
+}
+
+func (p *Publisher) diskTopic(name string) string {
+	return p.base + "/disk/" + name
+}
+
+func (p *Publisher) speedTestTopic() string {
+	return p.base + "/speedtest"
+}
+
+func (p *Publisher) commandTopic(jobName string) string {
+	return p.base + "/command/" + jobName
+}
+
+// onConnect runs on every (re)connect, with a clean session each time, so it
+// republishes everything retained and subscribes again.
+func (p *Publisher) onConnect(_ paho.Client) {
+	p.logger.Info().Str("broker", p.config.Broker).Msg("Connected to MQTT broker")
+
+	p.publish(p.availabilityTopic(), true, online)
+
+	p.mu.Lock()
+	clear(p.discovered)
+	p.mu.Unlock()
+	p.announce()
+
+	for _, sample := range p.store.LatestDiskSamples() {
+		p.publishDisk(sample)
+	}
+	if sample, ok := p.store.LatestSpeedTest(); ok {
+		p.publishSpeedTest(sample)
+	}
+
+	p.subscribe(p.commandTopic("+"), p.onCommand)
+	if p.config.DiscoveryPrefix != "" {
+		// Home Assistant announces itself here after a restart and expects
+		// the discovery configs again
+		p.subscribe(p.config.DiscoveryPrefix+"/status", func(_ paho.Client, m paho.Message) {
+			if string(m.Payload()) == online {
+				p.logger.Info().Msg("Home Assistant came online, announcing sensors again")
+				p.mu.Lock()
+				clear(p.discovered)
+				p.mu.Unlock()
+				p.announce()
+			}
+		})
+	}
+}
+
+func (p *Publisher) subscribe(topic string, handler paho.MessageHandler) {
+	token := p.client.Subscribe(topic, byte(p.config.Qos), handler)
+	if !token.WaitTimeout(publishTimeout) {
+		p.logger.Error().Str("topic", topic).Msg("Timed out subscribing")
+		return
+	}
+	if err := token.Error(); err != nil {
+		p.logger.Err(err).Str("topic", topic).Msg("Failed to subscribe")
+	}
+}
+
+// publish sends payload, encoding it as JSON unless it is a string.
+func (p *Publisher) publish(topic string, retained bool, payload any) {
+	var data []byte
+	switch v := payload.(type) {
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			p.logger.Err(err).Str("topic", topic).Msg("Failed to encode message")
+			return
+		}
+	}
+
+	token := p.client.Publish(topic, byte(p.config.Qos), retained, data)
+	if !token.WaitTimeout(publishTimeout) {
+		p.logger.Warn().Str("topic", topic).Msg("Timed out publishing")
+		return
+	}
+	if err := token.Error(); err != nil {
+		p.logger.Warn().Err(err).Str("topic", topic).Msg("Failed to publish")
+	}
+}
+
+func (p *Publisher) publishDisk(sample store.DiskSample) {
+	p.announceDisk(sample.Name)
+	p.publish(p.diskTopic(sample.Name), p.config.Retain, sample)
+}
+
+func (p *Publisher) publishSpeedTest(sample store.SpeedTestSample) {
+	p.publish(p.speedTestTopic(), p.config.Retain, sample)
+}
+
+// forward publishes samples from the event bus until Stop.
+func (p *Publisher) forward() {
+	defer close(p.done)
+	p.events.Follow(p.stop, p.handle)
+}
+
+func (p *Publisher) handle(e events.Event) {
+	if !p.client.IsConnectionOpen() {
+		// onConnect publishes the latest samples from the store
+		return
+	}
+
+	switch data := e.Data.(type) {
+	case store.DiskSample:
+		p.publishDisk(data)
+	case store.SpeedTestSample:
+		p.publishSpeedTest(data)
+	}
+}
+
+// onCommand runs the job named by the last topic level, with the rate limit
+// and overlap rules of the bot and REST triggers. The payload is ignored.
+func (p *Publisher) onCommand(_ paho.Client, m paho.Message) {
+	name := m.Topic()[strings.LastIndex(m.Topic(), "/")+1:]
+	logger := p.logger.With().Str("job", name).Logger()
+
+	cfg := p.live.Get()
+	def, ok := job.Lookup(name)
+	if !ok || !commandable(def, cfg) {
+		logger.Warn().Str("topic", m.Topic()).Msg("Command for unknown job, ignoring")
+		return
+	}
+	if p.executor.Closed() {
+		logger.Warn().Msg("Shutting down, ignoring command")
+		return
+	}
+	if !p.runner.CanExecuteCommand(def) {
+		logger.Warn().Msg("Job already running or rate limited, ignoring command")
+		return
+	}
+
+	logger.Info().Msg("Running job on MQTT command")
+	go p.runner.ExecuteJob(def, job.Deps{
+		Logger:   p.logger,
+		Config:   cfg,
+		Store:    p.store,
+		Notifier: p.runner,
+		Trigger:  job.TriggerMQTT,
+	})
+}
+
+// commandable reports whether def can be triggered over MQTT: bot commands,
+// minus jobs lacking the path they inspect.
+func commandable(def job.Definition, c *config.Config) bool {
+	return def.Command && (def.Path == nil || def.Path(c) != "")
+}
@@ -0,0 +1,310 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/store"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testJob  = "mqtt_test_job"
+	clientId = "servers-stats-box"
+	base     = "servers-stats/box"
+)
+
+var jobRan = make(chan job.Deps, 1)
+
+func init() {
+	job.Register(job.Definition{
+		Name:    testJob,
+		Title:   "MQTT test job",
+		Command: true,
+		Runner: func(d job.Deps) func(ctx context.Context) (any, error) {
+			return func(ctx context.Context) (any, error) {
+				jobRan <- d
+				return nil, nil
+			}
+		},
+	})
+}
+
+// runner stands in for the bot, running jobs straight on the executor.
+type runner struct {
+	executor *job.Executor
+}
+
+func (r runner) SendMessage(string) {}
+
+func (r runner) CanExecuteCommand(job.Definition) bool { return true }
+
+func (r runner) ExecuteJob(def job.Definition, d job.Deps) job.RunResult {
+	return r.executor.Run(context.Background(), def, d)
+}
+
+func startBroker(t *testing.T) (*mqttserver.Server, string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := srv.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddListener(listeners.NewNet("test", ln)); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, "tcp://" + ln.Addr().String()
+}
+
+func newPublisher(t *testing.T, broker string) (*Publisher, *store.Store) {
+	t.Helper()
+
+	l := zerolog.Nop()
+	live := config.NewLive(&config.Config{Mqtt: config.MqttConfig{
+		Broker:          broker,
+		TopicPrefix:     "servers-stats",
+		DiscoveryPrefix: "homeassistant",
+		NodeId:          "box",
+		Qos:             1,
+		Retain:          true,
+	}})
+	ev := events.New()
+	st, err := store.New(&l, t.TempDir(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ex := job.NewExecutor(&l, live, st, ev)
+
+	return NewPublisher(&l, live, runner{executor: ex}, st, ex, ev), st
+}
+
+func startPublisher(t *testing.T, broker string) *store.Store {
+	t.Helper()
+
+	p, st := newPublisher(t, broker)
+	p.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		p.Stop(ctx)
+	})
+	return st
+}
+
+// retained returns the payload retained on topic, if any.
+func retained(srv *mqttserver.Server, topic string) (string, bool) {
+	for _, pk := range srv.Topics.Messages(topic) {
+		return string(pk.Payload), true
+	}
+	return "", false
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func waitRetained(t *testing.T, srv *mqttserver.Server, topic string) string {
+	t.Helper()
+
+	var payload string
+	waitFor(t, topic, func() bool {
+		var ok bool
+		payload, ok = retained(srv, topic)
+		return ok
+	})
+	return payload
+}
+
+func TestDiscoveryAndState(t *testing.T) {
+	srv, broker := startBroker(t)
+	st := startPublisher(t, broker)
+
+	if got := waitRetained(t, srv, base+"/availability"); got != online {
+		t.Errorf("availability = %q, want %q", got, online)
+	}
+
+	st.RecordDiskSample(store.DiskSample{Name: "plex", Path: "/media", Percentage: 42, AvailBytes: 2e9, SampledAt: time.Now()}, "ok")
+	st.RecordSpeedTest(store.SpeedTestSample{DownloadMbps: 100.5, UploadMbps: 20, PingMs: 5, Status: "ok", SampledAt: time.Now()})
+
+	var d discovery
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, "homeassistant/sensor/box/disk_plex_usage/config")), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.StateTopic != base+"/disk/plex" || d.ValueTemplate != "{{ value_json.percentage }}" || d.UnitOfMeasurement != "%" {
+		t.Errorf("disk sensor config = %+v", d)
+	}
+	if d.AvailabilityTopic != base+"/availability" || d.UniqueId != "servers_stats_box_disk_plex_usage" {
+		t.Errorf("disk sensor identity = %+v", d)
+	}
+
+	d = discovery{}
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, "homeassistant/sensor/box/speedtest_download/config")), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.StateTopic != base+"/speedtest" || d.DeviceClass != "data_rate" {
+		t.Errorf("speedtest sensor config = %+v", d)
+	}
+
+	d = discovery{}
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, "homeassistant/button/box/"+testJob+"/config")), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.CommandTopic != base+"/command/"+testJob || d.PayloadPress != "PRESS" {
+		t.Errorf("button config = %+v", d)
+	}
+
+	var disk store.DiskSample
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, base+"/disk/plex")), &disk); err != nil {
+		t.Fatal(err)
+	}
+	if disk.Percentage != 42 || disk.Path != "/media" || disk.Status != "ok" {
+		t.Errorf("disk state = %+v", disk)
+	}
+
+	var speed store.SpeedTestSample
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, base+"/speedtest")), &speed); err != nil {
+		t.Fatal(err)
+	}
+	if speed.DownloadMbps != 100.5 || speed.PingMs != 5 {
+		t.Errorf("speedtest state = %+v", speed)
+	}
+}
+
+func TestCommandRunsJob(t *testing.T) {
+	srv, broker := startBroker(t)
+	st := startPublisher(t, broker)
+	waitRetained(t, srv, "homeassistant/button/box/"+testJob+"/config")
+
+	if err := srv.Publish(base+"/command/unknown_job", []byte("PRESS"), false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Publish(base+"/command/"+testJob, []byte("PRESS"), false, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-jobRan:
+		if d.Trigger != job.TriggerMQTT {
+			t.Errorf("trigger = %q, want %q", d.Trigger, job.TriggerMQTT)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("job did not run")
+	}
+
+	waitFor(t, "recorded run", func() bool {
+		run, ok := st.LastJobRun(testJob)
+		return ok && run.Trigger == job.TriggerMQTT && run.Outcome == job.OutcomeSuccess
+	})
+	if runs := st.JobRuns("unknown_job", 10); len(runs) != 0 {
+		t.Errorf("unknown job ran: %+v", runs)
+	}
+}
+
+func TestWillAndRepublishAfterReconnect(t *testing.T) {
+	srv, broker := startBroker(t)
+	st := startPublisher(t, broker)
+
+	st.RecordDiskSample(store.DiskSample{Name: "server", Path: "/", Percentage: 10, SampledAt: time.Now()}, "ok")
+	waitRetained(t, srv, base+"/disk/server")
+	waitRetained(t, srv, "homeassistant/sensor/box/disk_server_usage/config")
+
+	availability := make(chan string, 10)
+	err := srv.Subscribe(base+"/availability", 1, func(_ *mqttserver.Client, _ packets.Subscription, pk packets.Packet) {
+		availability <- string(pk.Payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-availability; got != online {
+		t.Fatalf("retained availability = %q, want %q", got, online)
+	}
+
+	// Clear what the publisher retained, so only a republish brings it back
+	for _, topic := range []string{base + "/disk/server", "homeassistant/sensor/box/disk_server_usage/config"} {
+		if err := srv.Publish(topic, nil, true, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cl, ok := srv.Clients.Get(clientId)
+	if !ok {
+		t.Fatal("publisher not connected")
+	}
+	cl.Stop(errors.New("connection dropped by test"))
+
+	for _, want := range []string{offline, online} {
+		select {
+		case got := <-availability:
+			if got != want {
+				t.Fatalf("availability = %q, want %q", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no %q on the availability topic", want)
+		}
+	}
+
+	var disk store.DiskSample
+	if err := json.Unmarshal([]byte(waitRetained(t, srv, base+"/disk/server")), &disk); err != nil {
+		t.Fatal(err)
+	}
+	if disk.Percentage != 10 {
+		t.Errorf("republished disk state = %+v", disk)
+	}
+	waitRetained(t, srv, "homeassistant/sensor/box/disk_server_usage/config")
+}
+
+func TestStopPublishesOffline(t *testing.T) {
+	srv, broker := startBroker(t)
+	p, _ := newPublisher(t, broker)
+	p.Start()
+	waitRetained(t, srv, base+"/availability")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := retained(srv, base+"/availability"); got != offline {
+		t.Errorf("availability after Stop = %q, want %q", got, offline)
+	}
+}
+
+func TestNoBroker(t *testing.T) {
+	l := zerolog.Nop()
+	if p := NewPublisher(&l, config.NewLive(&config.Config{}), nil, nil, nil, nil); p != nil {
+		t.Fatal("publisher created without a broker")
+	}
+}
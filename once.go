@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+	"github.com/koss-shtukert/servers-stats/logger"
+	"github.com/koss-shtukert/servers-stats/store"
+)
+
+type onceResult struct {
+	Job             string  `json:"job"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Detail          string  `json:"detail,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// runOnce runs every enabled job in turn, logging notifications instead of
+// sending them, and prints a Nagios status line followed by the results.
+// A failed job counts as critical.
+func runOnce(cfg *config.Config, format string) int {
+	logr, err := logger.NewConsole(cfg.LogLevel)
+	if err != nil {
+		fmt.Println("SERVERS-STATS UNKNOWN - logger error:", err)
+		return nagiosUnknown
+	}
+	logger.SetSecrets(cfg.Secrets())
+
+	st, err := store.NewReadOnly(&logr, cfg.DataDir)
+	if err != nil {
+		fmt.Println("SERVERS-STATS UNKNOWN - store error:", err)
+		return nagiosUnknown
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	executor := job.NewExecutor(&logr, config.NewLive(cfg), st, nil)
+	deps := job.Deps{
+		Logger:   &logr,
+		Config:   cfg,
+		Store:    st,
+		Notifier: common.LogNotifier{Logger: &logr},
+		Trigger:  job.TriggerOnce,
+	}
+
+	var results []onceResult
+	counts := map[string]int{}
+	code := nagiosOK
+	for _, def := range job.Definitions() {
+		if def.Enabled == nil || !def.Enabled(cfg) {
+			continue
+		}
+
+		res := executor.Run(ctx, def, deps)
+		r := onceResult{Job: def.Name, DurationSeconds: res.Duration.Seconds()}
+		if res.Err != nil {
+			r.Status, r.Error = common.StatusCritical, res.Err.Error()
+		} else {
+			r.Status, r.Detail = resultStatus(res.Result)
+		}
+
+		counts[r.Status]++
+		code = max(code, nagiosCode(r.Status))
+		results = append(results, r)
+	}
+	executor.Close()
+
+	if len(results) == 0 {
+		fmt.Println("SERVERS-STATS UNKNOWN - no jobs enabled")
+		return nagiosUnknown
+	}
+
+	if format == formatJSON {
+		printJSON(map[string]any{"status": nagiosStatus(code), "jobs": results})
+		return code
+	}
+
+	var summary []string
+	for _, status := range []string{common.StatusCritical, common.StatusWarning, common.StatusOK} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Printf("SERVERS-STATS %s - %s\n", strings.ToUpper(nagiosStatus(code)), strings.Join(summary, ", "))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSTATUS\tDURATION\tDETAIL")
+	for _, r := range results {
+		detail := r.Detail
+		if r.Error != "" {
+			detail = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1fs\t%s\n", r.Job, r.Status, r.DurationSeconds, detail)
+	}
+	w.Flush()
+	return code
+}
+
+// resultStatus derives a status from what a job returned. Jobs without a
+// measurable result, such as digests, are ok once they succeed.
+func resultStatus(result any) (string, string) {
+	switch r := result.(type) {
+	case *common.DiskUsageResult:
+		return common.DiskUsageStatus(r.Percentage), fmt.Sprintf("%s %d%% used, %s available", r.Path, r.Percentage, r.Available)
+	case *store.SpeedTestSample:
+		return r.Status, fmt.Sprintf("%.2f/%.2f Mbps down/up, %.1f ms ping", r.DownloadMbps, r.UploadMbps, r.PingMs)
+	}
+	return common.StatusOK, ""
+}
+
+func nagiosStatus(code int) string {
+	switch code {
+	case nagiosOK:
+		return common.StatusOK
+	case nagiosWarning:
+		return common.StatusWarning
+	case nagiosCritical:
+		return common.StatusCritical
+	}
+	return "unknown"
+}
@@ -0,0 +1,235 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+)
+
+// idleInterval is how often a disabled pusher checks whether a reload
+// enabled it.
+const idleInterval = time.Minute
+
+// Pusher pushes the metrics registry for hosts Prometheus can't scrape. It
+// reads metrics_push on every push, so reloads apply from the next one.
+type Pusher struct {
+	logger   *zerolog.Logger
+	config   *config.Live
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewPusher(l *zerolog.Logger, c *config.Live) *Pusher {
+	logger := l.With().Str("type", "push").Logger()
+
+	return &Pusher{
+		logger:   &logger,
+		config:   c,
+		gatherer: prometheus.DefaultGatherer,
+		client:   &http.Client{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *Pusher) Start() {
+	go p.loop()
+}
+
+// Stop ends the loop and pushes once more, so the metrics of jobs that ran
+// during shutdown aren't lost.
+func (p *Pusher) Stop(ctx context.Context) error {
+	close(p.stop)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c := p.config.Get().MetricsPush
+	if !enabled(c) {
+		return nil
+	}
+	p.push(ctx, c)
+	return ctx.Err()
+}
+
+func enabled(c config.MetricsPushConfig) bool {
+	return c.PushgatewayUrl != "" || c.RemoteWriteUrl != ""
+}
+
+func (p *Pusher) loop() {
+	defer close(p.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c := p.config.Get().MetricsPush
+	if enabled(c) {
+		p.logger.Info().Str("pushgateway", c.PushgatewayUrl).Str("remote_write", c.RemoteWriteUrl).Dur("interval", c.Interval).Msg("Pushing metrics")
+	}
+
+	for {
+		wait := idleInterval
+		if c := p.config.Get().MetricsPush; enabled(c) {
+			wait = c.Interval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if c := p.config.Get().MetricsPush; enabled(c) {
+			p.push(ctx, c)
+		}
+	}
+}
+
+// push sends the current metrics to every configured target, retrying each
+// with exponential backoff.
+func (p *Pusher) push(ctx context.Context, c config.MetricsPushConfig) {
+	labels := groupingLabels(c)
+
+	targets := []struct {
+		name, url string
+		send      func(ctx context.Context) error
+	}{
+		{"pushgateway", c.PushgatewayUrl, func(ctx context.Context) error {
+			return p.pushgateway(ctx, c, labels)
+		}},
+		{"remote_write", c.RemoteWriteUrl, func(ctx context.Context) error {
+			return p.remoteWrite(ctx, c, labels)
+		}},
+	}
+
+	for _, t := range targets {
+		if t.url == "" {
+			continue
+		}
+
+		start := time.Now()
+		attempts, err := common.Retry(ctx, c.Retries, func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+			return t.send(ctx)
+		})
+		if err != nil {
+			p.logger.Warn().Err(err).Str("target", t.name).Int("attempts", attempts).Msg("Failed to push metrics")
+			continue
+		}
+		p.logger.Debug().Str("target", t.name).Int("attempts", attempts).Dur("duration", time.Since(start)).Msg("Metrics pushed")
+	}
+}
+
+// groupingLabels returns the configured labels plus instance, which defaults
+// to the hostname so pushes from several hosts don't overwrite each other.
+func groupingLabels(c config.MetricsPushConfig) map[string]string {
+	labels := maps.Clone(c.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if labels["instance"] == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			labels["instance"] = hostname
+		}
+	}
+	labels["job"] = c.Job
+	return labels
+}
+
+// pushgateway replaces the metrics of the grouping key with a PUT. Client
+// errors other than 429 are not retried.
+func (p *Pusher) pushgateway(ctx context.Context, c config.MetricsPushConfig, labels map[string]string) error {
+	client := &statusRecorder{client: p.client}
+	pusher := push.New(c.PushgatewayUrl, c.Job).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return p.gather(labels)
+		})).
+		Client(client)
+	for _, name := range sortedNames(labels) {
+		if name != "job" {
+			pusher = pusher.Grouping(name, labels[name])
+		}
+	}
+	if c.Username != "" || c.Password != "" {
+		pusher = pusher.BasicAuth(c.Username, c.Password)
+	}
+	if c.BearerToken != "" {
+		pusher = pusher.Header(http.Header{"Authorization": {"Bearer " + c.BearerToken}})
+	}
+
+	if err := pusher.PushContext(ctx); err != nil {
+		err = fmt.Errorf("push to %s: %w", c.PushgatewayUrl, err)
+		if permanentStatus(client.status) {
+			return common.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// statusRecorder keeps the status of the last response, which the push
+// library only reports as text.
+type statusRecorder struct {
+	client *http.Client
+	status int
+}
+
+func (r *statusRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.client.Do(req)
+	if err == nil {
+		r.status = resp.StatusCode
+	}
+	return resp, err
+}
+
+// permanentStatus reports whether retrying a request answered with code is
+// pointless: client errors, except 429 Too Many Requests.
+func permanentStatus(code int) bool {
+	return code/100 == 4 && code != http.StatusTooManyRequests
+}
+
+// gather collects the registry, renaming metric labels that clash with the
+// grouping labels to exported_<name> as a Prometheus scrape would. The
+// Pushgateway rejects such metrics otherwise.
+func (p *Pusher) gather(labels map[string]string) ([]*dto.MetricFamily, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if _, clash := labels[lp.GetName()]; clash {
+					name := "exported_" + lp.GetName()
+					lp.Name = &name
+				}
+			}
+		}
+	}
+	return families, nil
+}
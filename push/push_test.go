@@ -0,0 +1,379 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// received is a request captured by the stand-in receiver.
+type received struct {
+	method, path string
+	header       http.Header
+	body         []byte
+}
+
+// receiver stands in for a Pushgateway or remote-write endpoint, answering
+// with the given statuses in turn and the last one from then on.
+type receiver struct {
+	mu       sync.Mutex
+	requests []received
+	statuses []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, received{req.Method, req.URL.EscapedPath(), req.Header.Clone(), body})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status = r.statuses[min(len(r.requests), len(r.statuses))-1]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv.URL
+}
+
+func (r *receiver) received() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.requests...)
+}
+
+// families returns a gauge with a job label clashing with the grouping
+// labels, a gauge with its own timestamp and a histogram.
+func families() []*dto.MetricFamily {
+	return []*dto.MetricFamily{
+		{
+			Name: proto.String("disk_usage_percent"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("disk"), Value: proto.String("server")},
+					{Name: proto.String("job"), Value: proto.String("disk_usage")},
+				},
+				Gauge: &dto.Gauge{Value: proto.Float64(42)},
+			}},
+		},
+		{
+			Name: proto.String("speedtest_download_mbps"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Gauge:       &dto.Gauge{Value: proto.Float64(100.5)},
+				TimestampMs: proto.Int64(1700000000000),
+			}},
+		},
+		{
+			Name: proto.String("job_duration_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(3),
+					SampleSum:   proto.Float64(4.5),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)},
+						{UpperBound: proto.Float64(5), CumulativeCount: proto.Uint64(3)},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newTestPusher(c config.MetricsPushConfig) *Pusher {
+	l := zerolog.Nop()
+	p := NewPusher(&l, config.NewLive(&config.Config{MetricsPush: c}))
+	p.gatherer = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families(), nil
+	})
+	return p
+}
+
+func testConfig() config.MetricsPushConfig {
+	return config.MetricsPushConfig{
+		Timeout: 5 * time.Second,
+		Retries: 1,
+		Job:     "servers-stats",
+		Labels:  map[string]string{"instance": "box", "site": "home"},
+	}
+}
+
+type series struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a snappy-compressed remote-write WriteRequest.
+func decodeWriteRequest(t *testing.T, body []byte) []series {
+	t.Helper()
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+
+	var out []series
+	for _, ts := range fields(t, data, writeRequestTimeseries) {
+		s := series{labels: map[string]string{}}
+		for _, lb := range fields(t, ts, timeSeriesLabels) {
+			name := fields(t, lb, labelName)
+			value := fields(t, lb, labelValue)
+			if len(name) != 1 || len(value) != 1 {
+				t.Fatalf("malformed label %x", lb)
+			}
+			s.labels[string(name[0])] = string(value[0])
+		}
+
+		samples := fields(t, ts, timeSeriesSamples)
+		if len(samples) != 1 {
+			t.Fatalf("got %d samples in a series, want 1", len(samples))
+		}
+		for b := samples[0]; len(b) > 0; {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			switch {
+			case num == sampleValue && typ == protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				s.value, b = math.Float64frombits(v), b[n:]
+			case num == sampleTimestamp && typ == protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				s.timestamp, b = int64(v), b[n:]
+			default:
+				t.Fatalf("unexpected sample field %d", num)
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// fields returns the length-delimited fields numbered num in message b.
+func fields(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	t.Helper()
+
+	var out [][]byte
+	for len(b) > 0 {
+		n, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			t.Fatalf("malformed tag: %v", protowire.ParseError(tagLen))
+		}
+		b = b[tagLen:]
+		valueLen := protowire.ConsumeFieldValue(n, typ, b)
+		if valueLen < 0 {
+			t.Fatalf("malformed field %d: %v", n, protowire.ParseError(valueLen))
+		}
+		if n == num && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			out = append(out, v)
+		}
+		b = b[valueLen:]
+	}
+	return out
+}
+
+func TestRemoteWrite(t *testing.T) {
+	r, url := newReceiver(t)
+	c := testConfig()
+	c.RemoteWriteUrl = url + "/api/v1/write"
+	c.BearerToken = "secret"
+
+	before := time.Now().UnixMilli()
+	newTestPusher(c).push(context.Background(), c)
+	after := time.Now().UnixMilli()
+
+	reqs := r.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.method != http.MethodPost || req.path != "/api/v1/write" {
+		t.Errorf("request = %s %s", req.method, req.path)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer secret",
+	} {
+		if got := req.header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	got := map[string]series{}
+	for _, s := range decodeWriteRequest(t, req.body) {
+		key := s.labels["__name__"]
+		if le, ok := s.labels["le"]; ok {
+			key += "{le=" + le + "}"
+		}
+		got[key] = s
+	}
+
+	disk, ok := got["disk_usage_percent"]
+	if !ok {
+		t.Fatalf("disk_usage_percent missing, got %v", got)
+	}
+	wantLabels := map[string]string{
+		"__name__":     "disk_usage_percent",
+		"disk":         "server",
+		"exported_job": "disk_usage",
+		"job":          "servers-stats",
+		"instance":     "box",
+		"site":         "home",
+	}
+	if len(disk.labels) != len(wantLabels) {
+		t.Errorf("labels = %v, want %v", disk.labels, wantLabels)
+	}
+	for k, v := range wantLabels {
+		if disk.labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, disk.labels[k], v)
+		}
+	}
+	if disk.value != 42 {
+		t.Errorf("disk_usage_percent = %v, want 42", disk.value)
+	}
+	if disk.timestamp < before || disk.timestamp > after {
+		t.Errorf("timestamp %d not within [%d, %d]", disk.timestamp, before, after)
+	}
+
+	if s := got["speedtest_download_mbps"]; s.value != 100.5 || s.timestamp != 1700000000000 {
+		t.Errorf("speedtest_download_mbps = %v at %d, want 100.5 at 1700000000000", s.value, s.timestamp)
+	}
+
+	for key, want := range map[string]float64{
+		"job_duration_seconds_bucket{le=1}":    1,
+		"job_duration_seconds_bucket{le=5}":    3,
+		"job_duration_seconds_bucket{le=+Inf}": 3,
+		"job_duration_seconds_sum":             4.5,
+		"job_duration_seconds_count":           3,
+	} {
+		if s, ok := got[key]; !ok || s.value != want {
+			t.Errorf("%s = %v (present %v), want %v", key, s.value, ok, want)
+		}
+	}
+}
+
+func TestPushgateway(t *testing.T) {
+	r, url := newReceiver(t)
+	c := testConfig()
+	c.PushgatewayUrl = url
+	c.Labels["path"] = "/mnt/data"
+	c.Username, c.Password = "user", "pass"
+
+	newTestPusher(c).push(context.Background(), c)
+
+	reqs := r.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	// PUT replaces every metric of the group, POST would only add to it
+	if req.method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", req.method)
+	}
+	// The grouping key follows the job in any order. Values containing a
+	// slash are base64-encoded, marked by @base64.
+	key, ok := strings.CutPrefix(req.path, "/metrics/job/servers-stats/")
+	if !ok {
+		t.Fatalf("path = %s, want /metrics/job/servers-stats/...", req.path)
+	}
+	grouping := map[string]string{}
+	parts := strings.Split(key, "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		grouping[parts[i]] = parts[i+1]
+	}
+	wantGrouping := map[string]string{"instance": "box", "path@base64": "L21udC9kYXRh", "site": "home"}
+	if len(parts)%2 != 0 || len(grouping) != len(wantGrouping) {
+		t.Errorf("path = %s, want grouping key %v", req.path, wantGrouping)
+	}
+	for k, v := range wantGrouping {
+		if grouping[k] != v {
+			t.Errorf("grouping %s = %q, want %q in %s", k, grouping[k], v, req.path)
+		}
+	}
+	if user, pass, ok := (&http.Request{Header: req.header}).BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+	}
+
+	dec := expfmt.NewDecoder(strings.NewReader(string(req.body)), expfmt.ResponseFormat(req.header))
+	var disk *dto.Metric
+	for {
+		var mf dto.MetricFamily
+		if err := dec.Decode(&mf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if mf.GetName() == "disk_usage_percent" {
+			disk = mf.Metric[0]
+		}
+	}
+	if disk == nil {
+		t.Fatal("disk_usage_percent not pushed")
+	}
+	labels := map[string]string{}
+	for _, lp := range disk.Label {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if _, ok := labels["job"]; ok || labels["exported_job"] != "disk_usage" || labels["disk"] != "server" {
+		t.Errorf("labels = %v, want job renamed to exported_job", labels)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"5xx retried", []int{http.StatusServiceUnavailable, http.StatusNoContent}, 2},
+		{"5xx gives up after retries", []int{http.StatusInternalServerError}, 2},
+		{"429 retried", []int{http.StatusTooManyRequests, http.StatusNoContent}, 2},
+		{"4xx not retried", []int{http.StatusBadRequest}, 1},
+	}
+
+	for _, target := range []string{"pushgateway", "remote_write"} {
+		for _, tt := range tests {
+			t.Run(target+"/"+tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				r, url := newReceiver(t, tt.statuses...)
+				c := testConfig()
+				if target == "pushgateway" {
+					c.PushgatewayUrl = url
+				} else {
+					c.RemoteWriteUrl = url
+				}
+
+				newTestPusher(c).push(context.Background(), c)
+				if got := len(r.received()); got != tt.attempts {
+					t.Errorf("got %d attempts, want %d", got, tt.attempts)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/config"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the remote-write protobuf messages, see
+// https://prometheus.io/docs/specs/remote_write_spec/
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+type label struct {
+	name, value string
+}
+
+// remoteWrite sends the registry as a snappy-compressed remote-write 1.0
+// WriteRequest. Client errors other than 429 are not retried.
+func (p *Pusher) remoteWrite(ctx context.Context, c config.MetricsPushConfig, labels map[string]string) error {
+	families, err := p.gather(labels)
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, labels, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.RemoteWriteUrl, bytes.NewReader(body))
+	if err != nil {
+		return common.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "servers-stats")
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write to %s: %s: %s", c.RemoteWriteUrl, resp.Status, bytes.TrimSpace(msg))
+	if permanentStatus(resp.StatusCode) {
+		return common.Permanent(err)
+	}
+	return err
+}
+
+// encodeWriteRequest converts families into one series per sample, the way
+// Prometheus stores them: histograms and summaries become their _bucket,
+// quantile, _sum and _count series.
+func encodeWriteRequest(families []*dto.MetricFamily, extra map[string]string, now time.Time) []byte {
+	var out []byte
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			base := make([]label, 0, len(m.Label)+len(extra))
+			for _, lp := range m.Label {
+				base = append(base, label{lp.GetName(), lp.GetValue()})
+			}
+			for _, k := range sortedNames(extra) {
+				base = append(base, label{k, extra[k]})
+			}
+			ts := now.UnixMilli()
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			add := func(name string, value float64, more ...label) {
+				out = appendSeries(out, name, append(append([]label(nil), base...), more...), value, ts)
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.Quantile {
+					add(name, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.Bucket {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				}
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return out
+}
+
+// appendSeries appends one TimeSeries holding a single sample to a
+// WriteRequest. Labels are sorted by name as the spec requires.
+func appendSeries(b []byte, name string, labels []label, value float64, ts int64) []byte {
+	labels = append(labels, label{"__name__", name})
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+	var series []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, labelName, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, labelValue, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+
+		series = protowire.AppendTag(series, timeSeriesLabels, protowire.BytesType)
+		series = protowire.AppendBytes(series, lb)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(ts))
+
+	series = protowire.AppendTag(series, timeSeriesSamples, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	b = protowire.AppendTag(b, writeRequestTimeseries, protowire.BytesType)
+	return protowire.AppendBytes(b, series)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
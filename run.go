@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/koss-shtukert/servers-stats/api"
+	"github.com/koss-shtukert/servers-stats/cron"
+	"github.com/koss-shtukert/servers-stats/cron/job"
+
+	"github.com/koss-shtukert/servers-stats/bot"
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/koss-shtukert/servers-stats/health"
+	"github.com/koss-shtukert/servers-stats/influx"
+	"github.com/koss-shtukert/servers-stats/logger"
+	"github.com/koss-shtukert/servers-stats/mqtt"
+	"github.com/koss-shtukert/servers-stats/push"
+	"github.com/koss-shtukert/servers-stats/store"
+	"github.com/koss-shtukert/servers-stats/telemetry"
+	"github.com/rs/zerolog"
+)
+
+// run starts the daemon, or with --once runs every enabled job a single time
+// and returns a Nagios exit code.
+func run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath, logLevel := commonFlags(fs)
+	once := fs.Bool("once", false, "run every enabled job once, print the results and exit with a Nagios exit code")
+	format := fs.String("format", formatTable, "output format for --once: table or json")
+	fs.Parse(args)
+	if *once && *format != formatTable && *format != formatJSON {
+		// Monitoring reads the status line from stdout, even for bad flags
+		fmt.Printf("SERVERS-STATS UNKNOWN - invalid --format %q, expected table or json\n", *format)
+		return nagiosUnknown
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		if *once {
+			fmt.Println("SERVERS-STATS UNKNOWN - config error:", err)
+			return nagiosUnknown
+		}
+		log.Fatal("Config error: ", err)
+	}
+	if *logLevel != "" {
+		cfg.OverrideLogLevel(*logLevel)
+	}
+
+	if *once {
+		return runOnce(cfg, *format)
+	}
+
+	logr, err := logger.New(cfg.LogLevel)
+	if err != nil {
+		log.Fatal("Logger error: ", err)
+	}
+	logger.SetSecrets(cfg.Secrets())
+
+	for _, w := range cfg.Warnings() {
+		logr.Warn().Str("type", "config").Msg(w)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tel, err := telemetry.New(&logr, cfg.Otel)
+	if err != nil {
+		log.Fatal("OpenTelemetry error: ", err)
+	}
+
+	live := config.NewLive(cfg)
+	ev := events.New()
+
+	st, err := store.New(&logr, cfg.DataDir, ev)
+	if err != nil {
+		log.Fatal("Store error: ", err)
+	}
+
+	executor := job.NewExecutor(&logr, live, st, ev)
+
+	tgBot, err := bot.CreateBot(live, &logr, st, executor)
+	if err != nil {
+		log.Fatal("Telegram bot error: ", err)
+	}
+
+	cronJob := cron.NewCron(&logr, live, tgBot, st, executor)
+
+	cronJob.AddJobs()
+
+	publisher := mqtt.NewPublisher(&logr, live, tgBot, st, executor, ev)
+	pusher := push.NewPusher(&logr, live)
+	exporter := influx.NewExporter(&logr, live, ev)
+
+	s := api.CreateServer(&logr, live, tgBot, st, executor, ev, health.NewChecker(live, tgBot, cronJob, st, executor))
+
+	// Outputs first, so they see the samples of catch-up runs
+	publisher.Start()
+	pusher.Start()
+	exporter.Start()
+
+	cronJob.Start()
+	logr.Info().Str("type", "core").Msg("Cron started")
+
+	tgBot.StartPolling(&logr)
+	logr.Info().Str("type", "core").Msg("Telegram polling started")
+
+	go func() {
+		if err := s.Start(); err != nil {
+			logr.Fatal().Err(err).Msg("Failed to start server")
+		}
+	}()
+	logr.Info().Str("type", "core").Msg("Server started")
+
+	config.Watch(ctx, &logr, *configPath, cfg.Files(), func(next *config.Config) {
+		if *logLevel != "" {
+			next.OverrideLogLevel(*logLevel)
+		}
+		logger.SetSecrets(next.Secrets())
+		reload(&logr, live, next, cronJob, tgBot, s)
+	}, func(err error) {
+		tgBot.SendMessage("⚠️ Config reload rejected, keeping the current config:\n" + err.Error())
+	})
+
+	<-ctx.Done()
+	logr.Info().Str("type", "core").Msg("Shutdown signal received")
+
+	// Graceful shutdown
+	shutdown(&logr, live, cronJob, executor, tgBot, publisher, pusher, exporter, s, st, tel)
+
+	logr.Info().Str("type", "core").Msg("Application shutdown complete")
+	return nagiosOK
+}
+
+// reload swaps in next and re-applies everything that can change at runtime.
+func reload(l *zerolog.Logger, live *config.Live, next *config.Config, c *cron.Cron, b *bot.Bot, s *api.Server) {
+	logger := l.With().Str("type", "core").Logger()
+
+	prev := live.Set(next)
+	if keys := config.RestartRequired(prev, next); len(keys) > 0 {
+		logger.Warn().Strs("keys", keys).Msg("Changed settings take effect after a restart")
+	}
+
+	for _, w := range next.Warnings() {
+		l.Warn().Str("type", "config").Msg(w)
+	}
+
+	if level, err := zerolog.ParseLevel(next.LogLevel); err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+	if err := b.Reload(next); err != nil {
+		logger.Error().Err(err).Msg("Failed to apply Telegram settings")
+	}
+	c.Reschedule()
+	s.Reload(next)
+
+	logger.Info().Msg("Config reloaded")
+}
+
+// shutdown stops every component in dependency order within
+// the configured shutdown_timeout, logging whatever had to be cut off.
+func shutdown(l *zerolog.Logger, live *config.Live, c *cron.Cron, ex *job.Executor, b *bot.Bot, p *mqtt.Publisher, mp *push.Pusher, ie *influx.Exporter, s *api.Server, st *store.Store, t *telemetry.Telemetry) {
+	logger := l.With().Str("type", "core").Logger()
+
+	ctx, cancel := context.WithTimeout(context.Background(), live.Get().ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting triggers from cron, bot and REST
+	ex.Close()
+	cronDone := c.Stop()
+	logger.Info().Msg("Stopped accepting job triggers")
+
+	select {
+	case <-cronDone.Done():
+	case <-ctx.Done():
+	}
+
+	if running := ex.Wait(ctx); len(running) > 0 {
+		logger.Warn().Strs("jobs", running).Msg("Shutdown deadline reached, cancelling running jobs")
+		ex.Cancel()
+	} else {
+		logger.Info().Msg("Running jobs finished")
+	}
+
+	if err := b.Drain(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Shutdown deadline reached, abandoning queued Telegram messages")
+	}
+
+	if err := b.StopPolling(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Shutdown deadline reached, Telegram poll still in progress")
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Shutdown deadline reached, MQTT disconnected abruptly")
+	}
+
+	if err := mp.Stop(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Shutdown deadline reached, final metrics push cut off")
+	}
+
+	if err := ie.Stop(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Shutdown deadline reached, pending InfluxDB points not written")
+	}
+
+	if err := s.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Error during server shutdown")
+	}
+
+	if err := st.Close(); err != nil {
+		logger.Error().Err(err).Msg("Failed to write history")
+	}
+
+	// Last, so the spans of jobs cut off above are exported too
+	if err := t.Shutdown(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Failed to flush OpenTelemetry data")
+	}
+}
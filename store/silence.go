@@ -0,0 +1,102 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/events"
+)
+
+// Silence mutes the scheduled Telegram notifications for an alert key, such
+// as disk:plex or speedtest, until Until. Alerts are still recorded.
+type Silence struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Until     time.Time `json:"until"`
+}
+
+func (s *Store) AddSilence(key, comment, createdBy string, until time.Time) Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	silence := Silence{
+		ID:        hex.EncodeToString(b),
+		Key:       key,
+		Comment:   comment,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		Until:     until,
+	}
+	s.data.Silences = append(s.data.Silences, silence)
+	s.persist()
+	s.events.Publish(events.Silence, silence)
+	return silence
+}
+
+// ExpireSilence ends the silence id now. It reports false for an unknown or
+// already expired silence.
+func (s *Store) ExpireSilence(id string) (Silence, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i, silence := range s.data.Silences {
+		if silence.ID != id || !silence.Until.After(now) {
+			continue
+		}
+		silence.Until = now
+		s.data.Silences = append(s.data.Silences[:i], s.data.Silences[i+1:]...)
+		s.persist()
+		s.events.Publish(events.Silence, silence)
+		return silence, true
+	}
+	return Silence{}, false
+}
+
+// Silences returns the silences in effect, ending soonest first.
+func (s *Store) Silences() []Silence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var out []Silence
+	for _, silence := range s.data.Silences {
+		if silence.Until.After(now) {
+			out = append(out, silence)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+func (s *Store) Silenced(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, silence := range s.data.Silences {
+		if silence.Key == key && silence.Until.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneSilences drops expired silences. Must be called with s.mu held.
+func (s *Store) pruneSilences() {
+	now := time.Now()
+	kept := s.data.Silences[:0]
+	for _, silence := range s.data.Silences {
+		if silence.Until.After(now) {
+			kept = append(kept, silence)
+		}
+	}
+	s.data.Silences = kept
+}
@@ -0,0 +1,474 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koss-shtukert/servers-stats/common"
+	"github.com/koss-shtukert/servers-stats/events"
+	"github.com/rs/zerolog"
+)
+
+const (
+	historyFile   = "history.json"
+	retention     = 8 * 24 * time.Hour
+	maxRunsPerJob = 100
+	// writeDelay batches the history writes of records made in a burst
+	writeDelay = 2 * time.Second
+)
+
+type DiskSample struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Percentage    int       `json:"percentage"`
+	UsedBytes     float64   `json:"used_bytes"`
+	AvailBytes    float64   `json:"avail_bytes"`
+	InodesTotal   uint64    `json:"inodes_total"`
+	InodesUsed    uint64    `json:"inodes_used"`
+	InodesPercent int       `json:"inodes_percent"`
+	Status        string    `json:"status"`
+	SampledAt     time.Time `json:"sampled_at"`
+}
+
+type SpeedTestSample struct {
+	DownloadMbps float64   `json:"download_mbps"`
+	UploadMbps   float64   `json:"upload_mbps"`
+	PingMs       float64   `json:"ping_ms"`
+	Status       string    `json:"status"`
+	ISP          string    `json:"isp"`
+	Server       string    `json:"server"`
+	SampledAt    time.Time `json:"sampled_at"`
+}
+
+type JobFailure struct {
+	Job   string    `json:"job"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+type AlertEvent struct {
+	Key      string    `json:"key"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous"`
+	Resolved bool      `json:"resolved"`
+	Detail   string    `json:"detail"`
+	At       time.Time `json:"at"`
+}
+
+type JobRun struct {
+	Job       string        `json:"job"`
+	Trigger   string        `json:"trigger"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Outcome   string        `json:"outcome"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type history struct {
+	Disks       []DiskSample         `json:"disks"`
+	SpeedTests  []SpeedTestSample    `json:"speed_tests"`
+	JobFailures []JobFailure         `json:"job_failures"`
+	Alerts      []AlertEvent         `json:"alerts"`
+	Runs        map[string][]JobRun  `json:"runs"`
+	Scheduled   map[string]time.Time `json:"scheduled"`
+	Statuses    map[string]string    `json:"statuses"`
+	Silences    []Silence            `json:"silences"`
+}
+
+type Store struct {
+	path   string
+	logger *zerolog.Logger
+	events *events.Bus
+	mu     sync.RWMutex
+	data   history
+	// readOnly keeps the history in memory only, see NewReadOnly
+	readOnly bool
+	// writeTimer is the pending history write, guarded by mu
+	writeTimer *time.Timer
+	// writeMu serialises history writes
+	writeMu sync.Mutex
+}
+
+func New(l *zerolog.Logger, dataDir string, ev *events.Bus) (*Store, error) {
+	logger := l.With().Str("type", "store").Logger()
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	return load(&logger, dataDir, ev)
+}
+
+// NewReadOnly loads the history of dataDir without ever writing it back, for
+// one-shot checks running next to a daemon that owns the file.
+func NewReadOnly(l *zerolog.Logger, dataDir string) (*Store, error) {
+	logger := l.With().Str("type", "store").Logger()
+
+	s, err := load(&logger, dataDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.readOnly = true
+	return s, nil
+}
+
+func load(logger *zerolog.Logger, dataDir string, ev *events.Bus) (*Store, error) {
+	s := &Store{
+		path:   filepath.Join(dataDir, historyFile),
+		logger: logger,
+		events: ev,
+		data: history{
+			Statuses:  make(map[string]string),
+			Runs:      make(map[string][]JobRun),
+			Scheduled: make(map[string]time.Time),
+		},
+	}
+
+	raw, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &s.data); err != nil {
+		logger.Err(err).Str("path", s.path).Msg("Failed to parse history, starting empty")
+		s.data = history{}
+	}
+	if s.data.Statuses == nil {
+		s.data.Statuses = make(map[string]string)
+	}
+	if s.data.Runs == nil {
+		s.data.Runs = make(map[string][]JobRun)
+	}
+	if s.data.Scheduled == nil {
+		s.data.Scheduled = make(map[string]time.Time)
+	}
+
+	return s, nil
+}
+
+func (s *Store) RecordDiskSample(sample DiskSample, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample.Status = status
+	s.data.Disks = append(s.data.Disks, sample)
+	s.events.Publish(events.DiskSample, sample)
+	s.observeStatus("disk:"+sample.Name, status, fmt.Sprintf("%s (%s) at %d%%", sample.Name, sample.Path, sample.Percentage), sample.SampledAt)
+	s.persist()
+}
+
+func (s *Store) RecordSpeedTest(sample SpeedTestSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.SpeedTests = append(s.data.SpeedTests, sample)
+	s.events.Publish(events.SpeedTestResult, sample)
+	s.observeStatus("speedtest", sample.Status, fmt.Sprintf("speedtest ⬇️ %.2f ⬆️ %.2f Mbps, ping %.1f ms", sample.DownloadMbps, sample.UploadMbps, sample.PingMs), sample.SampledAt)
+	s.persist()
+}
+
+func (s *Store) RecordJobFailure(job string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.JobFailures = append(s.data.JobFailures, JobFailure{
+		Job:   job,
+		Error: err.Error(),
+		At:    time.Now(),
+	})
+	s.persist()
+}
+
+func (s *Store) RecordJobRun(run JobRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := append(s.data.Runs[run.Job], run)
+	if len(runs) > maxRunsPerJob {
+		runs = runs[len(runs)-maxRunsPerJob:]
+	}
+	s.data.Runs[run.Job] = runs
+	s.persist()
+}
+
+// JobRuns returns up to limit most recent runs of job, newest first.
+func (s *Store) JobRuns(job string, limit int) []JobRun {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := s.data.Runs[job]
+	if limit <= 0 || limit > len(runs) {
+		limit = len(runs)
+	}
+
+	out := make([]JobRun, 0, limit)
+	for i := len(runs) - 1; i >= len(runs)-limit; i-- {
+		out = append(out, runs[i])
+	}
+	return out
+}
+
+func (s *Store) LastJobRun(job string) (JobRun, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := s.data.Runs[job]
+	if len(runs) == 0 {
+		return JobRun{}, false
+	}
+	return runs[len(runs)-1], true
+}
+
+func (s *Store) LastSuccessfulRun(job string) (JobRun, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := s.data.Runs[job]
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Outcome == "success" {
+			return runs[i], true
+		}
+	}
+	return JobRun{}, false
+}
+
+// RecordScheduledRun remembers when the scheduler last fired job, so runs
+// missed while the process was down can be caught up on startup.
+func (s *Store) RecordScheduledRun(job string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Scheduled[job] = at
+	s.persist()
+}
+
+func (s *Store) LastScheduledRun(job string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	at, ok := s.data.Scheduled[job]
+	return at, ok
+}
+
+// LatestDiskSamples returns the newest sample of every disk, sorted by name.
+func (s *Store) LatestDiskSamples() []DiskSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var out []DiskSample
+	for i := len(s.data.Disks) - 1; i >= 0; i-- {
+		d := s.data.Disks[i]
+		if !seen[d.Name] {
+			seen[d.Name] = true
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *Store) LatestSpeedTest() (SpeedTestSample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.data.SpeedTests) == 0 {
+		return SpeedTestSample{}, false
+	}
+	return s.data.SpeedTests[len(s.data.SpeedTests)-1], true
+}
+
+func (s *Store) DiskSamplesSince(since time.Time) []DiskSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []DiskSample
+	for _, d := range s.data.Disks {
+		if !d.SampledAt.Before(since) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func (s *Store) SpeedTestsSince(since time.Time) []SpeedTestSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []SpeedTestSample
+	for _, t := range s.data.SpeedTests {
+		if !t.SampledAt.Before(since) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (s *Store) JobFailuresSince(since time.Time) []JobFailure {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []JobFailure
+	for _, f := range s.data.JobFailures {
+		if !f.At.Before(since) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (s *Store) AlertsSince(since time.Time) []AlertEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []AlertEvent
+	for _, a := range s.data.Alerts {
+		if !a.At.Before(since) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// ActiveAlerts returns the event that raised each alert still not back to
+// OK, sorted by key.
+func (s *Store) ActiveAlerts() []AlertEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []AlertEvent
+	for key, status := range s.data.Statuses {
+		if status == common.StatusOK {
+			continue
+		}
+		for i := len(s.data.Alerts) - 1; i >= 0; i-- {
+			if a := s.data.Alerts[i]; a.Key == key {
+				out = append(out, a)
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// observeStatus records an alert event whenever the status for key moves
+// away from or back to OK. Must be called with s.mu held.
+func (s *Store) observeStatus(key, status, detail string, at time.Time) {
+	if status == "" {
+		return
+	}
+
+	previous, ok := s.data.Statuses[key]
+	if !ok {
+		previous = common.StatusOK
+	}
+	s.data.Statuses[key] = status
+
+	if previous == status {
+		return
+	}
+
+	alert := AlertEvent{
+		Key:      key,
+		Status:   status,
+		Previous: previous,
+		Resolved: status == common.StatusOK,
+		Detail:   detail,
+		At:       at,
+	}
+	s.data.Alerts = append(s.data.Alerts, alert)
+	s.events.Publish(events.Alert, alert)
+}
+
+// persist trims entries older than the retention window and schedules a
+// write of the history. Must be called with s.mu held.
+func (s *Store) persist() {
+	if s.readOnly {
+		return
+	}
+
+	cutoff := time.Now().Add(-retention)
+
+	s.data.Disks = trim(s.data.Disks, func(d DiskSample) time.Time { return d.SampledAt }, cutoff)
+	s.data.SpeedTests = trim(s.data.SpeedTests, func(t SpeedTestSample) time.Time { return t.SampledAt }, cutoff)
+	s.data.JobFailures = trim(s.data.JobFailures, func(f JobFailure) time.Time { return f.At }, cutoff)
+	s.data.Alerts = trim(s.data.Alerts, func(a AlertEvent) time.Time { return a.At }, cutoff)
+	s.pruneSilences()
+
+	if s.writeTimer == nil {
+		s.writeTimer = time.AfterFunc(writeDelay, func() {
+			if err := s.write(); err != nil {
+				s.logger.Err(err).Str("path", s.path).Msg("Failed to write history")
+			}
+		})
+	}
+}
+
+// Close writes the changes not written yet. Records made afterwards are
+// still written after writeDelay.
+func (s *Store) Close() error {
+	if s.readOnly {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.writeTimer != nil {
+		s.writeTimer.Stop()
+	}
+	s.mu.Unlock()
+	return s.write()
+}
+
+// write replaces the history file with the current history. Readers are
+// only held up while the history is encoded, and a crash leaves either the
+// old or the new file in place.
+func (s *Store) write() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	s.writeTimer = nil
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	raw, err := json.Marshal(s.data)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encode history: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(raw)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func trim[T any](items []T, at func(T) time.Time, cutoff time.Time) []T {
+	i := 0
+	for i < len(items) && at(items[i]).Before(cutoff) {
+		i++
+	}
+	return items[i:]
+}
@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/koss-shtukert/servers-stats/config"
+	"github.com/rs/zerolog"
+	prometheusbridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Telemetry exports spans and the metrics registry over OTLP. The otel block
+// is read once, changes need a restart.
+type Telemetry struct {
+	logger   *zerolog.Logger
+	shutdown []func(context.Context) error
+}
+
+// New installs the global tracer and meter providers. With no endpoint
+// configured it installs nothing and spans stay no-ops.
+func New(l *zerolog.Logger, c config.OtelConfig) (*Telemetry, error) {
+	logger := l.With().Str("type", "otel").Logger()
+	t := &Telemetry{logger: &logger}
+	if c.Endpoint == "" || (!c.Traces && !c.Metrics) {
+		return t, nil
+	}
+
+	ctx := context.Background()
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(c.ServiceName)),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn().Err(err).Msg("OpenTelemetry export failed")
+	}))
+
+	if c.Traces {
+		exporter, err := traceExporter(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		)
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		t.shutdown = append(t.shutdown, tp.Shutdown)
+	}
+
+	if c.Metrics {
+		exporter, err := metricExporter(ctx, c)
+		if err != nil {
+			return nil, errors.Join(err, t.Shutdown(ctx))
+		}
+		mp := sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter,
+				sdkmetric.WithInterval(c.MetricsInterval),
+				sdkmetric.WithProducer(prometheusbridge.NewMetricProducer()),
+			)),
+		)
+		otel.SetMeterProvider(mp)
+		t.shutdown = append(t.shutdown, mp.Shutdown)
+	}
+
+	logger.Info().Str("endpoint", c.Endpoint).Str("protocol", c.Protocol).Bool("traces", c.Traces).Bool("metrics", c.Metrics).Msg("Exporting over OTLP")
+	return t, nil
+}
+
+func traceExporter(ctx context.Context, c config.OtelConfig) (sdktrace.SpanExporter, error) {
+	if c.Protocol == "grpc" {
+		return otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(c.Endpoint))
+	}
+	return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(signalUrl(c.Endpoint, "traces")))
+}
+
+func metricExporter(ctx context.Context, c config.OtelConfig) (sdkmetric.Exporter, error) {
+	if c.Protocol == "grpc" {
+		return otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(c.Endpoint))
+	}
+	return otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(signalUrl(c.Endpoint, "metrics")))
+}
+
+// signalUrl appends the per-signal path OTLP/HTTP collectors expect to the
+// base endpoint.
+func signalUrl(endpoint, signal string) string {
+	return strings.TrimRight(endpoint, "/") + "/v1/" + signal
+}
+
+// Shutdown flushes the spans and metrics not exported yet.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, shutdown := range t.shutdown {
+		errs = append(errs, shutdown(ctx))
+	}
+	t.shutdown = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/koss-shtukert/servers-stats"
+
+// Start begins a span under ctx. Spans are no-ops until a tracer provider is
+// installed, i.e. while OTLP export is off.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span failed if err is set and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Logger returns l with the trace_id and span_id of ctx, so log lines can be
+// matched to traces. l is returned as is when ctx isn't traced.
+func Logger(ctx context.Context, l *zerolog.Logger) *zerolog.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if l == nil || !sc.IsValid() {
+		return l
+	}
+
+	logger := l.With().Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String()).Logger()
+	return &logger
+}